@@ -0,0 +1,417 @@
+package typhoon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Layout of the dates in vanilla ban lists.
+const vanillaTimeLayout = "2006-01-02 15:04:05 -0700"
+
+const vanillaForever = "forever"
+
+// BanEntry is an entry of a player or IP ban list. A zero Expires means
+// the ban never expires.
+type BanEntry struct {
+	UUID    string
+	Name    string
+	IP      string
+	Created time.Time
+	Source  string
+	Expires time.Time
+	Reason  string
+}
+
+type banEntryJSON struct {
+	UUID    string `json:"uuid,omitempty"`
+	Name    string `json:"name,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+func (entry BanEntry) MarshalJSON() ([]byte, error) {
+	expires := vanillaForever
+	if !entry.Expires.IsZero() {
+		expires = entry.Expires.Format(vanillaTimeLayout)
+	}
+	return json.Marshal(banEntryJSON{
+		UUID:    entry.UUID,
+		Name:    entry.Name,
+		IP:      entry.IP,
+		Created: entry.Created.Format(vanillaTimeLayout),
+		Source:  entry.Source,
+		Expires: expires,
+		Reason:  entry.Reason,
+	})
+}
+
+func (entry *BanEntry) UnmarshalJSON(data []byte) error {
+	var raw banEntryJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	entry.UUID = strings.ToLower(raw.UUID)
+	entry.Name = raw.Name
+	entry.IP = raw.IP
+	entry.Source = raw.Source
+	entry.Reason = raw.Reason
+	entry.Created, _ = time.Parse(vanillaTimeLayout, raw.Created)
+	entry.Expires = time.Time{}
+	if raw.Expires != "" && raw.Expires != vanillaForever {
+		expires, err := time.Parse(vanillaTimeLayout, raw.Expires)
+		if err != nil {
+			return err
+		}
+		entry.Expires = expires
+	}
+	return nil
+}
+
+// IsExpired reports whether the ban is over at the given time.
+func (entry *BanEntry) IsExpired(now time.Time) bool {
+	return !entry.Expires.IsZero() && !now.Before(entry.Expires)
+}
+
+func (entry *BanEntry) key() string {
+	if entry.IP != "" {
+		return entry.IP
+	}
+	return entry.UUID
+}
+
+// BanList is a ban list stored in the vanilla banned-players.json or
+// banned-ips.json format. Player bans are keyed by UUID, IP bans by
+// address. Every change is saved to the file immediately.
+type BanList struct {
+	path    string
+	entries map[string]*BanEntry
+	mutex   *sync.RWMutex
+}
+
+// WhitelistEntry is an entry of the vanilla whitelist.json file.
+type WhitelistEntry struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type Whitelist struct {
+	path    string
+	entries map[string]WhitelistEntry
+	enabled int32
+	mutex   *sync.RWMutex
+}
+
+// readListFile decodes a JSON list file, leaving v untouched when the file
+// does not exist.
+func readListFile(path string, v interface{}) error {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func writeListFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadBanList reads a ban list, which is empty when the file does not
+// exist yet. An empty path keeps the list in memory only.
+func LoadBanList(path string) (*BanList, error) {
+	list := &BanList{
+		path:    path,
+		entries: make(map[string]*BanEntry),
+		mutex:   &sync.RWMutex{},
+	}
+	if path == "" {
+		return list, nil
+	}
+	entries := make([]*BanEntry, 0)
+	if err := readListFile(path, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for _, entry := range entries {
+		list.entries[entry.key()] = entry
+	}
+	return list, nil
+}
+
+func (list *BanList) save() error {
+	entries := make([]*BanEntry, 0, len(list.entries))
+	for _, entry := range list.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return writeListFile(list.path, entries)
+}
+
+// Add bans the UUID or IP address of the entry, replacing any previous ban.
+// The list is left unchanged when it can't be saved.
+func (list *BanList) Add(entry BanEntry) error {
+	entry.UUID = strings.ToLower(entry.UUID)
+	if entry.Created.IsZero() {
+		entry.Created = time.Now()
+	}
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	previous, ok := list.entries[entry.key()]
+	list.entries[entry.key()] = &entry
+	err := list.save()
+	if err != nil && ok {
+		list.entries[entry.key()] = previous
+	} else if err != nil {
+		delete(list.entries, entry.key())
+	}
+	return err
+}
+
+// Remove lifts the ban of a UUID, IP address or player name, and reports
+// whether there was one. The ban stays when the list can't be saved.
+func (list *BanList) Remove(target string) (bool, error) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	entry := list.find(target)
+	if entry == nil {
+		return false, nil
+	}
+	delete(list.entries, entry.key())
+	if err := list.save(); err != nil {
+		list.entries[entry.key()] = entry
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns the active ban of a UUID, IP address or player name, or nil.
+func (list *BanList) Get(target string) *BanEntry {
+	list.mutex.RLock()
+	entry := list.find(target)
+	list.mutex.RUnlock()
+	if entry == nil || entry.IsExpired(time.Now()) {
+		return nil
+	}
+	copied := *entry
+	return &copied
+}
+
+func (list *BanList) find(target string) *BanEntry {
+	if entry, ok := list.entries[strings.ToLower(target)]; ok {
+		return entry
+	}
+	if entry, ok := list.entries[target]; ok {
+		return entry
+	}
+	for _, entry := range list.entries {
+		if entry.Name != "" && strings.EqualFold(entry.Name, target) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// GetEntries returns the active bans, oldest first.
+func (list *BanList) GetEntries() []BanEntry {
+	now := time.Now()
+	list.mutex.RLock()
+	entries := make([]BanEntry, 0, len(list.entries))
+	for _, entry := range list.entries {
+		if !entry.IsExpired(now) {
+			entries = append(entries, *entry)
+		}
+	}
+	list.mutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries
+}
+
+// LoadWhitelist reads a whitelist, which is empty when the file does not
+// exist yet. An empty path keeps the list in memory only.
+func LoadWhitelist(path string, enabled bool) (*Whitelist, error) {
+	list := &Whitelist{
+		path:    path,
+		entries: make(map[string]WhitelistEntry),
+		enabled: 0,
+		mutex:   &sync.RWMutex{},
+	}
+	list.SetEnabled(enabled)
+	if path == "" {
+		return list, nil
+	}
+	entries := make([]WhitelistEntry, 0)
+	if err := readListFile(path, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for _, entry := range entries {
+		entry.UUID = strings.ToLower(entry.UUID)
+		list.entries[entry.UUID] = entry
+	}
+	return list, nil
+}
+
+func (list *Whitelist) IsEnabled() bool {
+	return atomic.LoadInt32(&list.enabled) == 1
+}
+
+func (list *Whitelist) SetEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&list.enabled, 1)
+	} else {
+		atomic.StoreInt32(&list.enabled, 0)
+	}
+}
+
+func (list *Whitelist) save() error {
+	entries := list.unsortedEntries()
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return writeListFile(list.path, entries)
+}
+
+func (list *Whitelist) unsortedEntries() []WhitelistEntry {
+	entries := make([]WhitelistEntry, 0, len(list.entries))
+	for _, entry := range list.entries {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Add adds a player to the whitelist. The list is left unchanged when it
+// can't be saved.
+func (list *Whitelist) Add(uuid string, name string) error {
+	uuid = strings.ToLower(uuid)
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	previous, ok := list.entries[uuid]
+	list.entries[uuid] = WhitelistEntry{uuid, name}
+	err := list.save()
+	if err != nil && ok {
+		list.entries[uuid] = previous
+	} else if err != nil {
+		delete(list.entries, uuid)
+	}
+	return err
+}
+
+// Remove removes a UUID or player name from the whitelist, and reports
+// whether it was on it. The player stays when the list can't be saved.
+func (list *Whitelist) Remove(target string) (bool, error) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	for uuid, entry := range list.entries {
+		if uuid == strings.ToLower(target) || strings.EqualFold(entry.Name, target) {
+			delete(list.entries, uuid)
+			if err := list.save(); err != nil {
+				list.entries[uuid] = entry
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Contains reports whether a UUID or player name is on the whitelist.
+func (list *Whitelist) Contains(target string) bool {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	if _, ok := list.entries[strings.ToLower(target)]; ok {
+		return true
+	}
+	for _, entry := range list.entries {
+		if strings.EqualFold(entry.Name, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEntries returns the whitelisted players sorted by name.
+func (list *Whitelist) GetEntries() []WhitelistEntry {
+	list.mutex.RLock()
+	entries := list.unsortedEntries()
+	list.mutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries
+}
+
+func (c *Core) GetBannedPlayers() *BanList {
+	return c.bannedPlayers
+}
+
+func (c *Core) GetBannedIps() *BanList {
+	return c.bannedIps
+}
+
+func (c *Core) GetWhitelist() *Whitelist {
+	return c.whitelist
+}
+
+func (c *Core) loadAccessLists(config AccessConfig) (err error) {
+	if c.bannedPlayers, err = LoadBanList(config.BannedPlayers); err != nil {
+		return
+	}
+	if c.bannedIps, err = LoadBanList(config.BannedIps); err != nil {
+		return
+	}
+	c.whitelist, err = LoadWhitelist(config.Whitelist, config.EnforceWhitelist)
+	return
+}
+
+func banMessage(prefix string, entry *BanEntry) string {
+	msg := prefix + "\nReason: " + entry.Reason
+	if !entry.Expires.IsZero() {
+		msg += "\nYour ban will be removed on " + entry.Expires.Format(vanillaTimeLayout)
+	}
+	return msg
+}
+
+// checkAccess returns the reason why the player can't log in and its kick
+// category, or an empty string if it can. Players are also matched by
+// name, as offline UUIDs depend on the case of the name.
+func (player *Player) checkAccess() (string, kickCategory) {
+	core := player.core
+	entry := core.bannedPlayers.Get(player.uuid)
+	if entry == nil {
+		entry = core.bannedPlayers.Get(player.name)
+	}
+	if entry != nil {
+		return banMessage("You are banned from this server.", entry), kickBanned
+	}
+	if entry := core.bannedIps.Get(connectionHost(player.conn.RemoteAddr())); entry != nil {
+		return banMessage("Your IP address is banned from this server.", entry), kickBanned
+	}
+	if core.whitelist.IsEnabled() && !core.whitelist.Contains(player.uuid) && !core.whitelist.Contains(player.name) {
+		return "You are not white-listed on this server!", kickNotWhitelisted
+	}
+	return "", ""
+}
@@ -0,0 +1,220 @@
+package typhoon
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+const defaultBanReason = "Banned by an operator."
+
+func commandError(sender CommandSender, message string) {
+	m := ChatMessage(message)
+	m.SetColor(&ChatColorRed)
+	sender.SendMessage(m)
+}
+
+func commandReason(ctx *CommandContext) string {
+	if ctx.Has("reason") {
+		return ctx.GetString("reason")
+	}
+	return defaultBanReason
+}
+
+// resolveProfile returns the UUID and name of an online player, or the
+// offline UUID of the name.
+func (c *Core) resolveProfile(name string) (string, string) {
+	if player := c.playerRegistry.GetPlayerByName(name); player != nil {
+		return player.uuid, player.name
+	}
+	return OfflineUUID(name), name
+}
+
+func targetArgument(name string, children []*CommandNode, execute CommandExecutor) *CommandNode {
+	return CommandNodeArgument(name, children, &CommandParserString{Format: CommandParserStringFormatSingleWord}, execute).Suggest(SuggestPlayers)
+}
+
+// suggestBanned suggests the names and addresses on a ban list.
+func suggestBanned(list func() *BanList) SuggestionProvider {
+	return func(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+		entries := list().GetEntries()
+		suggestions := make([]CommandSuggestion, len(entries))
+		for i, entry := range entries {
+			suggestions[i] = CommandSuggestion{Text: entry.Name}
+			if entry.IP != "" {
+				suggestions[i].Text = entry.IP
+			}
+		}
+		return suggestions
+	}
+}
+
+func suggestWhitelisted(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+	entries := core.whitelist.GetEntries()
+	suggestions := make([]CommandSuggestion, len(entries))
+	for i, entry := range entries {
+		suggestions[i] = CommandSuggestion{Text: entry.Name}
+	}
+	return suggestions
+}
+
+func reasonArgument(execute CommandExecutor) *CommandNode {
+	return CommandNodeArgument("reason", nil, &CommandParserString{Format: CommandParserStringFormatGreedyPhrase}, execute)
+}
+
+// BanCommand returns the /ban <player> [reason] command.
+func (c *Core) BanCommand() *CommandNode {
+	execute := func(ctx *CommandContext) {
+		sender := ctx.GetSender()
+		uuid, name := c.resolveProfile(ctx.GetString("target"))
+		reason := commandReason(ctx)
+		err := c.bannedPlayers.Add(BanEntry{
+			UUID:   uuid,
+			Name:   name,
+			Source: sender.GetName(),
+			Reason: reason,
+		})
+		if err != nil {
+			c.Log(LevelError, "Can't save ban list", LogFields{"error": err})
+			ctx.Fail("Could not save the ban list")
+			return
+		}
+		if player := c.playerRegistry.GetPlayerByUUID(uuid); player != nil {
+			player.kick(kickBanned, "You are banned from this server.\nReason: "+reason)
+		}
+		sender.SendMessage(ChatMessage("Banned " + name + ": " + reason))
+	}
+	return CommandNodeLiteral("ban", []*CommandNode{
+		targetArgument("target", []*CommandNode{reasonArgument(execute)}, execute),
+	}, nil).RequirePermission("typhoon.command.ban")
+}
+
+// BanIpCommand returns the /ban-ip <address|player> [reason] command. The
+// address and the reason are read from a single greedy argument, as IPv6
+// addresses aren't single words.
+func (c *Core) BanIpCommand() *CommandNode {
+	execute := func(ctx *CommandContext) {
+		sender := ctx.GetSender()
+		args := strings.SplitN(strings.TrimSpace(ctx.GetString("target")), " ", 2)
+		ip := args[0]
+		if net.ParseIP(ip) == nil {
+			player := c.playerRegistry.GetPlayerByName(ip)
+			if player == nil {
+				ctx.Fail("Invalid IP address or unknown player")
+				return
+			}
+			ip = connectionHost(player.conn.RemoteAddr())
+		}
+		reason := defaultBanReason
+		if len(args) == 2 && strings.TrimSpace(args[1]) != "" {
+			reason = strings.TrimSpace(args[1])
+		}
+		err := c.bannedIps.Add(BanEntry{
+			IP:     ip,
+			Source: sender.GetName(),
+			Reason: reason,
+		})
+		if err != nil {
+			c.Log(LevelError, "Can't save IP ban list", LogFields{"error": err})
+			ctx.Fail("Could not save the ban list")
+			return
+		}
+		for _, player := range c.playerRegistry.GetPlayers() {
+			if connectionHost(player.conn.RemoteAddr()) == ip {
+				player.kick(kickBanned, "Your IP address is banned from this server.\nReason: "+reason)
+			}
+		}
+		sender.SendMessage(ChatMessage("Banned IP " + ip + ": " + reason))
+	}
+	return CommandNodeLiteral("ban-ip", []*CommandNode{
+		CommandNodeArgument("target", nil, &CommandParserString{Format: CommandParserStringFormatGreedyPhrase}, execute).Suggest(SuggestPlayers),
+	}, nil).RequirePermission("typhoon.command.ban-ip")
+}
+
+func pardonCommand(c *Core, name string, list func() *BanList, format CommandParserStringFormat) *CommandNode {
+	return CommandNodeLiteral(name, []*CommandNode{
+		CommandNodeArgument("target", nil, &CommandParserString{Format: format}, func(ctx *CommandContext) {
+			target := strings.TrimSpace(ctx.GetString("target"))
+			removed, err := list().Remove(target)
+			if err != nil {
+				c.Log(LevelError, "Can't save ban list", LogFields{"error": err})
+				ctx.Fail("Could not save the ban list")
+				return
+			}
+			if !removed {
+				ctx.Fail("Nothing changed. " + target + " isn't banned")
+				return
+			}
+			ctx.GetSender().SendMessage(ChatMessage("Unbanned " + target))
+		}).Suggest(suggestBanned(list)),
+	}, nil).RequirePermission("typhoon.command." + name)
+}
+
+// PardonCommand returns the /pardon <player> command.
+func (c *Core) PardonCommand() *CommandNode {
+	return pardonCommand(c, "pardon", c.GetBannedPlayers, CommandParserStringFormatSingleWord)
+}
+
+// PardonIpCommand returns the /pardon-ip <address> command.
+func (c *Core) PardonIpCommand() *CommandNode {
+	return pardonCommand(c, "pardon-ip", c.GetBannedIps, CommandParserStringFormatGreedyPhrase)
+}
+
+// WhitelistCommand returns the /whitelist <add|remove|list|on|off> command.
+func (c *Core) WhitelistCommand() *CommandNode {
+	return CommandNodeLiteral("whitelist", []*CommandNode{
+		CommandNodeLiteral("add", []*CommandNode{
+			targetArgument("target", nil, func(ctx *CommandContext) {
+				uuid, name := c.resolveProfile(ctx.GetString("target"))
+				if err := c.whitelist.Add(uuid, name); err != nil {
+					c.Log(LevelError, "Can't save whitelist", LogFields{"error": err})
+					ctx.Fail("Could not save the whitelist")
+					return
+				}
+				ctx.GetSender().SendMessage(ChatMessage("Added " + name + " to the whitelist"))
+			}),
+		}, nil),
+		CommandNodeLiteral("remove", []*CommandNode{
+			targetArgument("target", nil, func(ctx *CommandContext) {
+				target := ctx.GetString("target")
+				removed, err := c.whitelist.Remove(target)
+				if err != nil {
+					c.Log(LevelError, "Can't save whitelist", LogFields{"error": err})
+					ctx.Fail("Could not save the whitelist")
+					return
+				}
+				if !removed {
+					ctx.Fail("Player is not whitelisted")
+					return
+				}
+				ctx.GetSender().SendMessage(ChatMessage("Removed " + target + " from the whitelist"))
+			}).Suggest(suggestWhitelisted),
+		}, nil),
+		CommandNodeLiteral("list", nil, func(ctx *CommandContext) {
+			entries := c.whitelist.GetEntries()
+			names := make([]string, len(entries))
+			for i, entry := range entries {
+				names[i] = entry.Name
+			}
+			ctx.GetSender().SendMessage(ChatMessage("There are " + strconv.Itoa(len(names)) + " whitelisted players: " + strings.Join(names, ", ")))
+		}),
+		CommandNodeLiteral("on", nil, func(ctx *CommandContext) {
+			c.whitelist.SetEnabled(true)
+			ctx.GetSender().SendMessage(ChatMessage("Whitelist is now turned on"))
+		}),
+		CommandNodeLiteral("off", nil, func(ctx *CommandContext) {
+			c.whitelist.SetEnabled(false)
+			ctx.GetSender().SendMessage(ChatMessage("Whitelist is now turned off"))
+		}),
+	}, nil).RequirePermission("typhoon.command.whitelist")
+}
+
+// DeclareAccessCommands declares /ban, /ban-ip, /pardon, /pardon-ip and
+// /whitelist.
+func (c *Core) DeclareAccessCommands() {
+	c.DeclareCommand(c.BanCommand())
+	c.DeclareCommand(c.BanIpCommand())
+	c.DeclareCommand(c.PardonCommand())
+	c.DeclareCommand(c.PardonIpCommand())
+	c.DeclareCommand(c.WhitelistCommand())
+}
@@ -0,0 +1,153 @@
+package typhoon
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBanListVanillaFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "typhoon-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "banned-players.json")
+	err = ioutil.WriteFile(path, []byte(`[
+  {"uuid": "B50AD385-829D-3141-A216-7E7D7539BA7F", "name": "Notch", "created": "2019-12-01 10:00:00 +0100",
+   "source": "Server", "expires": "forever", "reason": "Griefing"},
+  {"uuid": "00000000-0000-3000-8000-000000000001", "name": "Old", "created": "2019-12-01 10:00:00 +0100",
+   "source": "Server", "expires": "2019-12-02 10:00:00 +0100", "reason": "Spam"}
+]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := list.Get("b50ad385-829d-3141-a216-7e7d7539ba7f")
+	if entry == nil || entry.Name != "Notch" || entry.Reason != "Griefing" || !entry.Expires.IsZero() {
+		t.Fatal("Invalid entry", entry)
+	}
+	if list.Get("notch") == nil {
+		t.Log("Bans must be found by name")
+		t.Fail()
+	}
+	if list.Get("Old") != nil {
+		t.Log("Expired ban is still active")
+		t.Fail()
+	}
+
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := list.Add(BanEntry{UUID: OfflineUUID("Steve"), Name: "Steve", Source: "CONSOLE", Expires: expires, Reason: "Test"}); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := list.Remove("NOTCH"); !removed || err != nil {
+		t.Fatal("Remove failed", err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []map[string]string
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 || saved[1]["name"] != "Steve" || saved[1]["expires"] != "2030-01-01 00:00:00 +0000" {
+		t.Log("Invalid saved file", string(raw))
+		t.Fail()
+	}
+}
+
+func TestLoginAccess(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Access = AccessConfig{}
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	player := &Player{core: c, conn: conn, name: "Steve", uuid: OfflineUUID("Steve")}
+
+	if reason, _ := player.checkAccess(); reason != "" {
+		t.Fatal("Player refused:", reason)
+	}
+
+	console := newConsoleSender(bytes.NewBuffer(nil))
+	c.DeclareAccessCommands()
+	c.DispatchCommand(console, "ban steve Too many creepers")
+	if reason, _ := player.checkAccess(); !strings.Contains(reason, "Too many creepers") {
+		t.Log("Banned player allowed:", reason)
+		t.Fail()
+	}
+	c.DispatchCommand(console, "pardon Steve")
+	c.DispatchCommand(console, "whitelist on")
+	if reason, _ := player.checkAccess(); reason != "You are not white-listed on this server!" {
+		t.Log("Player not on the whitelist allowed:", reason)
+		t.Fail()
+	}
+	c.DispatchCommand(console, "whitelist add Steve")
+	if reason, _ := player.checkAccess(); reason != "" {
+		t.Log("Whitelisted player refused:", reason)
+		t.Fail()
+	}
+
+	c.DispatchCommand(console, "ban-ip 2001:db8::1 Proxy abuse")
+	if entry := c.GetBannedIps().Get("2001:db8::1"); entry == nil || entry.Reason != "Proxy abuse" {
+		t.Log("IPv6 address not banned:", entry)
+		t.Fail()
+	}
+	c.DispatchCommand(console, "pardon-ip 2001:db8::1")
+	if entry := c.GetBannedIps().Get("2001:db8::1"); entry != nil {
+		t.Log("IPv6 address not pardoned:", entry)
+		t.Fail()
+	}
+}
+
+func TestAccessListSaveFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "typhoon-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "missing")
+
+	bans, err := LoadBanList(filepath.Join(missing, "banned-players.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bans.Add(BanEntry{UUID: OfflineUUID("Steve"), Name: "Steve"}); err == nil || bans.Get("Steve") != nil {
+		t.Log("Ban kept after a failed save", err)
+		t.Fail()
+	}
+	bans.entries[OfflineUUID("Notch")] = &BanEntry{UUID: OfflineUUID("Notch"), Name: "Notch"}
+	if removed, err := bans.Remove("Notch"); removed || err == nil || bans.Get("Notch") == nil {
+		t.Log("Ban lifted after a failed save", removed, err)
+		t.Fail()
+	}
+
+	whitelist, err := LoadWhitelist(filepath.Join(missing, "whitelist.json"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := whitelist.Add(OfflineUUID("Steve"), "Steve"); err == nil || whitelist.Contains("Steve") {
+		t.Log("Player whitelisted after a failed save", err)
+		t.Fail()
+	}
+	whitelist.entries[OfflineUUID("Notch")] = WhitelistEntry{OfflineUUID("Notch"), "Notch"}
+	if removed, err := whitelist.Remove("Notch"); removed || err == nil || !whitelist.Contains("Notch") {
+		t.Log("Player removed from the whitelist after a failed save", removed, err)
+		t.Fail()
+	}
+}
@@ -30,7 +30,10 @@ func (buff *VarBuffer) Bytes() []byte {
 
 func (buff *VarBuffer) Write(p []byte) (n int, err error) {
 	if len(buff.buffer)-buff.used < len(p) {
-		size := len(p) + (len(buff.buffer) - buff.used)
+		size := 2 * len(buff.buffer)
+		if size < buff.used+len(p) {
+			size = buff.used + len(p)
+		}
 		nbuffer := make([]byte, size)
 		copy(nbuffer, buff.buffer)
 		buff.buffer = nbuffer
@@ -62,3 +62,28 @@ func TestVarBufferWriteWithResize(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestVarBufferWriteWithResizeAfterWrite(t *testing.T) {
+	buff := newVarBuffer(20)
+
+	data := make([]byte, 50)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	buff.Write(data[:15])
+	buff.Write(data[15:])
+
+	if !bytes.Equal(data, buff.Bytes()) {
+		t.Log("VarBuffer corrupted data")
+		t.Fail()
+	}
+}
+
+func TestVarIntSize(t *testing.T) {
+	for value, size := range map[int]int{0: 1, 127: 1, 128: 2, 16383: 2, 16384: 3, 2097152: 4} {
+		if varIntSize(value) != size {
+			t.Log("Invalid VarInt size of", value, varIntSize(value))
+			t.Fail()
+		}
+	}
+}
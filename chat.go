@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strconv"
 )
 
@@ -95,6 +94,13 @@ func ChatClickRunCommand(command string) *ChatAction {
 	}
 }
 
+func ChatClickSuggestCommand(command string) *ChatAction {
+	return &ChatAction{
+		chatClickTypeSuggestCommand,
+		command,
+	}
+}
+
 func ChatHoverText(component string) *ChatAction {
 	return &ChatAction{
 		chatHoverTypeShowText,
@@ -199,6 +205,40 @@ func ChatMessage(text string) *StringChatComponent {
 		}}
 }
 
+// ChatPlainText returns the text of a component and of its extras,
+// without any formatting.
+func ChatPlainText(component IChatComponent) string {
+	msg, err := component.JSON()
+	if err != nil {
+		return ""
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(msg), &decoded); err != nil {
+		return ""
+	}
+	buff := bytes.NewBufferString("")
+	chatPlainText(buff, decoded)
+	return buff.String()
+}
+
+func chatPlainText(buff *bytes.Buffer, component interface{}) {
+	switch c := component.(type) {
+	case string:
+		buff.WriteString(c)
+	case []interface{}:
+		for _, extra := range c {
+			chatPlainText(buff, extra)
+		}
+	case map[string]interface{}:
+		if text, ok := c["text"].(string); ok {
+			buff.WriteString(text)
+		}
+		if extra, ok := c["extra"]; ok {
+			chatPlainText(buff, extra)
+		}
+	}
+}
+
 func BukkitMessageConvert(message string) IChatComponent {
 	base := ChatMessage("")
 
@@ -242,6 +282,7 @@ func BukkitMessageConvert(message string) IChatComponent {
 			buff.WriteByte(message[i])
 		}
 	}
+	current.Text = buff.String()
 
 	return base
 }
@@ -249,7 +290,7 @@ func BukkitMessageConvert(message string) IChatComponent {
 func (p *Player) SendMessage(message IChatComponent) {
 	msg, err := message.JSON()
 	if err != nil {
-		log.Fatal(err)
+		p.Log(LevelError, "Can't encode chat message", LogFields{"error": err})
 		return
 	}
 	p.WritePacket(&PacketPlayMessage{
@@ -261,7 +302,7 @@ func (p *Player) SendMessage(message IChatComponent) {
 func (p *Player) SendBukkitMessage(message string) {
 	msg, err := BukkitMessageConvert(message).JSON()
 	if err != nil {
-		log.Fatal(err)
+		p.Log(LevelError, "Can't encode chat message", LogFields{"error": err})
 		return
 	}
 	p.WritePacket(&PacketPlayMessage{
@@ -280,7 +321,7 @@ func (p *Player) SendRawMessage(message string) {
 func (p *Player) SendActionBar(message IChatComponent) {
 	msg, err := message.JSON()
 	if err != nil {
-		log.Fatal(err)
+		p.Log(LevelError, "Can't encode chat message", LogFields{"error": err})
 		return
 	}
 	p.WritePacket(&PacketPlayMessage{
@@ -0,0 +1,18 @@
+package typhoon
+
+import "testing"
+
+func TestBukkitMessageConvert(t *testing.T) {
+	tests := map[string]string{
+		"plain":             "plain",
+		"&ared":             "red",
+		"&d[Notch] &rhello": "[Notch] hello",
+		"trailing &":        "trailing &",
+	}
+	for message, expected := range tests {
+		if text := ChatPlainText(BukkitMessageConvert(message)); text != expected {
+			t.Logf("Converted %q to %q instead of %q", message, text, expected)
+			t.Fail()
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package typhoon
 
 import (
-	"log"
 	"strings"
+	"time"
 )
 
 type CommandNodeType uint8
@@ -25,34 +25,46 @@ const (
 
 type CommandParser interface {
 	GetId() string
-	IsMultiple() bool
-	IsValid(string) bool
-	IsArrayValid([]string) bool
+	Parse(reader *StringReader) (interface{}, error)
 	GetSuggestion() CommandSuggestionType
 	Complete(string) []string
 	writeProperties(*Player) error
 }
 
+// RedirectModifier returns the senders the rest of a forked command runs
+// as. The command stops when it returns no sender.
+type RedirectModifier func(ctx *CommandContext) []CommandSender
+
 type CommandNode struct {
 	Type         CommandNodeType
-	Execute      func(player *Player, args []string)
+	Execute      CommandExecutor
 	Children     []*CommandNode
 	RedirectNode *CommandNode
+	Modifier     RedirectModifier
 	Name         string
 	Parser       CommandParser
+	Permission   string
+	Requires     func(sender CommandSender) bool
+	Suggestions  SuggestionProvider
+	Cooldown     *CommandCooldown
 }
 
 func CommandNodeLiteral(
 	name string,
 	children []*CommandNode,
-	execute func(player *Player, args []string)) *CommandNode {
+	execute CommandExecutor) *CommandNode {
 	return &CommandNode{
 		CommandNodeTypeLiteral,
 		execute,
 		children,
 		nil,
+		nil,
 		name,
 		nil,
+		"",
+		nil,
+		nil,
+		nil,
 	}
 }
 
@@ -60,103 +72,275 @@ func CommandNodeArgument(
 	name string,
 	children []*CommandNode,
 	parser CommandParser,
-	execute func(player *Player, args []string)) *CommandNode {
+	execute CommandExecutor) *CommandNode {
 	return &CommandNode{
 		CommandNodeTypeArgument,
 		execute,
 		children,
 		nil,
+		nil,
 		name,
 		parser,
+		"",
+		nil,
+		nil,
+		nil,
 	}
 }
 
+// RequirePermission hides the node and its children from the senders
+// lacking the permission, and prevents them from executing it.
+func (node *CommandNode) RequirePermission(permission string) *CommandNode {
+	node.Permission = permission
+	return node
+}
+
+// Require hides the node and its children from the senders for which the
+// predicate returns false, and prevents them from executing it. Call
+// UpdateCommands when the outcome of the predicate changes.
+func (node *CommandNode) Require(requires func(sender CommandSender) bool) *CommandNode {
+	node.Requires = requires
+	return node
+}
+
+// Redirect continues the command after the node with the children of the
+// target, the target being declared elsewhere in the graph.
+func (node *CommandNode) Redirect(target *CommandNode) *CommandNode {
+	node.RedirectNode = target
+	return node
+}
+
+// Fork redirects the node to the target, and runs the rest of the command
+// once for each sender returned by the modifier.
+func (node *CommandNode) Fork(target *CommandNode, modifier RedirectModifier) *CommandNode {
+	node.RedirectNode = target
+	node.Modifier = modifier
+	return node
+}
+
+// redirected returns the node whose children follow the node.
+func (node *CommandNode) redirected() *CommandNode {
+	if node.RedirectNode != nil {
+		return node.RedirectNode
+	}
+	return node
+}
+
+// canUse reports whether the sender holds the permission of the node and
+// satisfies its predicate.
+func (node *CommandNode) canUse(sender CommandSender) bool {
+	if node.Permission != "" && !sender.HasPermission(node.Permission) {
+		return false
+	}
+	return node.Requires == nil || node.Requires(sender)
+}
+
+// DeclareCommand adds a command to the graph, and sends the updated graph
+// to the players already online.
 func (c *Core) DeclareCommand(graph *CommandNode) {
-	c.rootCommand.Children = append(c.rootCommand.Children, graph)
-	c.compileCommands()
+	c.commandMutex.Lock()
+	children := make([]*CommandNode, len(c.rootCommand.Children), len(c.rootCommand.Children)+1)
+	copy(children, c.rootCommand.Children)
+	c.rootCommand.Children = append(children, graph)
+	c.commandMutex.Unlock()
+	c.UpdateCommands()
 }
 
-func (c *Core) onCommand(player *Player, command string) {
-	args := strings.Split(command, " ")
+// DeclareAlias declares a command redirecting to the target, which must be
+// in the graph. The alias requires the permission of the target and shares
+// its cooldown.
+func (c *Core) DeclareAlias(alias string, target *CommandNode) *CommandNode {
+	node := CommandNodeLiteral(alias, nil, target.Execute).Redirect(target)
+	node.Permission = target.Permission
+	node.Requires = target.Requires
+	node.Cooldown = target.Cooldown
+	c.DeclareCommand(node)
+	return node
+}
 
-	node := &c.rootCommand
-	if !c.analyseCommand(player, args, node, 0) {
-		m := ChatMessage("Unknown command")
-		m.SetColor(&ChatColorRed)
-		player.SendMessage(m)
+// UpdateCommands sends the command graph to every player again.
+func (c *Core) UpdateCommands() {
+	for _, player := range c.playerRegistry.GetPlayers() {
+		player.UpdateCommands()
 	}
 }
 
-func (c *Core) analyseCommand(player *Player, args []string, node *CommandNode, step int) bool {
-	if len(args) > step {
-		for _, child := range node.Children {
-			switch child.Type {
-			case CommandNodeTypeLiteral:
-				if child.Name == args[step] {
-					return c.analyseCommand(player, args, child, step+1)
-				}
-			case CommandNodeTypeArgument:
-				if child.Parser.IsMultiple() {
-					if child.Parser.IsArrayValid(args[step:]) {
-						return c.analyseCommand(player, args, child, step+1)
-					}
-				} else {
-					if child.Parser.IsValid(args[step]) {
-						return c.analyseCommand(player, args, child, step+1)
-					}
-				}
-			}
-		}
+// UpdateCommands sends the commands the player can use, on 1.13 and
+// later, once the player joined the game. It is called when the
+// permissions of the player change, from any goroutine: the graph is
+// compiled under the write lock so the last one sent is the latest.
+func (player *Player) UpdateCommands() {
+	if player.protocol < V1_13 {
+		return
 	}
-	if node.Execute != nil {
-		node.Execute(player, args)
-		return true
+	player.writeMutex.Lock()
+	defer player.writeMutex.Unlock()
+	if !player.joined {
+		return
 	}
-	return false
+	player.writePacket(&PacketPlayDeclareCommands{
+		player.core.compileCommands(player),
+		0,
+	})
 }
 
-func (c *Core) onTabCommand(player *Player, command string) {
-	args := strings.Split(command, " ")
+// DispatchCommand runs a command, with or without its leading slash, as
+// the given sender.
+func (c *Core) DispatchCommand(sender CommandSender, command string) {
+	c.onCommand(sender, strings.TrimPrefix(command, "/"))
+}
 
-	node := &c.rootCommand
-	player.WritePacket(&PacketPlayTabComplete{
-		c.analyseTabCommand(player, args, node, 0),
+// onCommand fires a PreCommandEvent, which can cancel or rewrite the
+// command, runs it and fires a PostCommandEvent.
+func (c *Core) onCommand(sender CommandSender, command string) {
+	pre := &PreCommandEvent{
+		Sender:  sender,
+		Command: command,
+	}
+	c.CallEvent(pre)
+	if pre.Cancelled {
+		return
+	}
+	start := time.Now()
+	success := c.runCommand(sender, pre.Command)
+	c.CallEvent(&PostCommandEvent{
+		Sender:   sender,
+		Command:  pre.Command,
+		Success:  success,
+		Duration: time.Since(start),
 	})
 }
 
-func commandJoin(args []string, attr string) string {
-	str := attr
-	if len(args) == 0 {
-		str = "/" + str
+// runCommand parses and executes a command once the cooldowns allow it,
+// and reports whether it succeeded. The cooldowns start only then.
+func (c *Core) runCommand(sender CommandSender, command string) bool {
+	c.commandMutex.RLock()
+	node, path, err := c.parseCommand(sender, NewStringReader(command), &c.rootCommand, nil)
+	c.commandMutex.RUnlock()
+	if err != nil {
+		sender.SendMessage(err.Component())
+		return false
+	}
+	cooldowns := pathCooldowns(path)
+	if c.getConfig().Commands.Cooldown > 0 {
+		cooldowns = append([]*CommandCooldown{nil}, cooldowns...)
+	}
+	if !c.checkCooldowns(sender, cooldowns) {
+		return false
 	}
-	return str
+	if !c.executeCommand(sender, command, node, path, 0) {
+		return false
+	}
+	c.startCooldowns(sender, cooldowns)
+	return true
 }
 
-func (c *Core) analyseTabCommand(player *Player, args []string, node *CommandNode, step int) []string {
-	strs := make([]string, 0)
-	if len(args) > step {
-		for _, child := range node.Children {
-			switch child.Type {
-			case CommandNodeTypeLiteral:
-				if len(args)-1 == step && strings.HasPrefix(child.Name, args[step]) {
-					strs = append(strs, commandJoin(args[:len(args)-1], child.Name))
-				} else {
-					if child.Name == args[step] {
-						strs = append(strs, c.analyseTabCommand(player, args, child, step+1)...)
-					}
-				}
-			case CommandNodeTypeArgument:
-				if child.Parser.IsMultiple() {
-					if child.Parser.IsArrayValid(args[step:]) {
-						strs = append(strs, strings.Join(args, " "))
-					}
-				} else {
-					strs = append(strs, child.Parser.Complete(args[step])...)
+// executeCommand runs the node as the sender, forking the command at the
+// first node of the path from the index redirecting with a modifier, and
+// reports whether one of the runs didn't fail.
+func (c *Core) executeCommand(sender CommandSender, command string, node *CommandNode, path []parsedArgument, from int) bool {
+	for i := from; i < len(path)-1; i++ {
+		if modifier := path[i].node.Modifier; modifier != nil {
+			success := false
+			for _, forked := range modifier(newCommandContext(c, sender, command, path[:i+1])) {
+				if c.executeCommand(forked, command, node, path, i+1) {
+					success = true
 				}
 			}
+			return success
+		}
+	}
+	ctx := newCommandContext(c, sender, command, path)
+	node.Execute(ctx)
+	return !ctx.failed
+}
+
+const (
+	commandUnknownCommand  = "Unknown or incomplete command, see below for error"
+	commandUnknownArgument = "Incorrect argument for command"
+)
+
+// parseCommand follows the children of the node matching the input, or
+// those of its redirection, and returns the node to execute with the
+// arguments read on the way. When
+// nothing matches, the error reached furthest in the input is returned.
+func (c *Core) parseCommand(sender CommandSender, reader *StringReader, node *CommandNode, path []parsedArgument) (*CommandNode, []parsedArgument, *CommandSyntaxError) {
+	reader.SkipWhitespace()
+	if !reader.CanRead() {
+		if node.Execute != nil {
+			return node, path, nil
+		}
+		return nil, nil, reader.Errorf(commandUnknownCommand)
+	}
+
+	start := reader.GetCursor()
+	var failure *CommandSyntaxError
+	failures := 0
+	for _, child := range node.redirected().Children {
+		if !child.canUse(sender) {
+			continue
+		}
+		reader.SetCursor(start)
+		argument, err := child.parse(reader)
+		if err == nil && reader.CanRead() && reader.Peek() != ' ' {
+			err = reader.Errorf("Expected whitespace to end one argument, but found trailing data")
+		}
+		if err == nil {
+			var found *CommandNode
+			var foundPath []parsedArgument
+			found, foundPath, err = c.parseCommand(sender, reader, child, append(path[:len(path):len(path)], argument))
+			if err == nil {
+				return found, foundPath, nil
+			}
+		}
+		if failure == nil || err.Cursor > failure.Cursor {
+			failure, failures = err, 1
+		} else if err.Cursor == failure.Cursor {
+			failures++
+		}
+	}
+	reader.SetCursor(start)
+	if failure == nil || failures > 1 || failure.Message == "" {
+		cursor := start
+		if failure != nil {
+			cursor = failure.Cursor
+		}
+		if node.redirected().Type == commandNodeTypeRoot && cursor == start {
+			return nil, nil, reader.errorAt(cursor, commandUnknownCommand)
 		}
+		return nil, nil, reader.errorAt(cursor, commandUnknownArgument)
 	}
-	return strs
+	return nil, nil, failure
+}
+
+// parse reads the node from the input. A literal that does not match
+// fails with an empty message, standing for a generic error.
+func (node *CommandNode) parse(reader *StringReader) (parsedArgument, *CommandSyntaxError) {
+	start := reader.GetCursor()
+	if node.Type == CommandNodeTypeLiteral {
+		if !strings.HasPrefix(reader.GetRemaining(), node.Name) {
+			return parsedArgument{}, reader.errorAt(start, "")
+		}
+		reader.SetCursor(start + len(node.Name))
+		if reader.CanRead() && reader.Peek() != ' ' {
+			reader.SetCursor(start)
+			return parsedArgument{}, reader.errorAt(start, "")
+		}
+		return parsedArgument{node, node.Name, node.Name}, nil
+	}
+
+	value, err := node.Parser.Parse(reader)
+	if err != nil {
+		if syntax, ok := err.(*CommandSyntaxError); ok {
+			return parsedArgument{}, syntax
+		}
+		return parsedArgument{}, reader.errorAt(start, "%s", err.Error())
+	}
+	raw, ok := value.(string)
+	if !ok {
+		raw = reader.GetString()[start:reader.GetCursor()]
+	}
+	return parsedArgument{node, raw, value}, nil
 }
 
 type commandNode struct {
@@ -166,35 +350,39 @@ type commandNode struct {
 	RedirectNode int
 	Name         string
 	Parser       CommandParser
+	Suggestion   CommandSuggestionType
 }
 
-func countNodes(node *CommandNode) int {
-	i := 1
-	for _, n := range node.Children {
-		i += countNodes(n)
+// nodeRefs indexes the nodes of the graph the sender can use, a node shared
+// by several parents getting a single index.
+func nodeRefs(sender CommandSender, refs map[*CommandNode]int, node *CommandNode, index int) int {
+	if _, ok := refs[node]; ok {
+		return 0
 	}
-	return i
-}
-
-func nodeRefs(refs map[*CommandNode]int, node *CommandNode, index int) int {
 	refs[node] = index
 	i := 1
 	for _, n := range node.Children {
-		i += nodeRefs(refs, n, index+i)
+		if n.canUse(sender) {
+			i += nodeRefs(sender, refs, n, index+i)
+		}
 	}
 	return i
 }
 
 func compileNode(compile []commandNode, refs map[*CommandNode]int, node *CommandNode) {
-	children := make([]int, len(node.Children))
-	for i, n := range node.Children {
-		compileNode(compile, refs, n)
-		children[i] = refs[n]
+	children := make([]int, 0, len(node.Children))
+	for _, n := range node.Children {
+		if _, ok := refs[n]; ok {
+			compileNode(compile, refs, n)
+			children = append(children, refs[n])
+		}
 	}
 
 	redirect := -1
 	if node.RedirectNode != nil {
-		redirect = refs[node.RedirectNode]
+		if ref, ok := refs[node.RedirectNode]; ok {
+			redirect = ref
+		}
 	}
 
 	compile[refs[node]] = commandNode{
@@ -204,16 +392,20 @@ func compileNode(compile []commandNode, refs map[*CommandNode]int, node *Command
 		redirect,
 		node.Name,
 		node.Parser,
+		node.getSuggestion(),
 	}
 }
 
-func (c *Core) compileCommands() {
-	count := countNodes(&c.rootCommand)
+// compileCommands flattens the command graph for PacketPlayDeclareCommands,
+// leaving out the nodes the sender can't use.
+func (c *Core) compileCommands(sender CommandSender) []commandNode {
+	c.commandMutex.RLock()
+	defer c.commandMutex.RUnlock()
+	refs := make(map[*CommandNode]int)
+	count := nodeRefs(sender, refs, &c.rootCommand, 0)
 	commands := make([]commandNode, count)
-	refs := make(map[*CommandNode]int, count)
-	nodeRefs(refs, &c.rootCommand, 0)
 	compileNode(commands, refs, &c.rootCommand)
-	c.compiledCommands = commands
+	return commands
 }
 
 func (node *commandNode) flags() uint8 {
@@ -224,7 +416,7 @@ func (node *commandNode) flags() uint8 {
 	if node.RedirectNode != -1 {
 		flags |= 0x08
 	}
-	if node.Parser != nil && node.Parser.GetSuggestion() != CommandSuggestionNone {
+	if node.Suggestion != CommandSuggestionNone {
 		flags |= 0x10
 	}
 	return flags
@@ -233,25 +425,25 @@ func (node *commandNode) flags() uint8 {
 func (node *commandNode) writeTo(player *Player) (err error) {
 	err = player.WriteUInt8(node.flags())
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteVarInt(len(node.Children))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	for _, child := range node.Children {
 		err = player.WriteVarInt(child)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if node.RedirectNode != -1 {
 		err = player.WriteVarInt(node.RedirectNode)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -259,22 +451,22 @@ func (node *commandNode) writeTo(player *Player) (err error) {
 		node.Type == CommandNodeTypeLiteral {
 		err = player.WriteString(node.Name)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if node.Type == CommandNodeTypeArgument {
 		err = player.WriteString(node.Parser.GetId())
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 		node.Parser.writeProperties(player)
 	}
-	if node.Parser != nil && node.Parser.GetSuggestion() != CommandSuggestionNone {
-		err = player.WriteString(string(node.Parser.GetSuggestion()))
+	if node.Suggestion != CommandSuggestionNone {
+		err = player.WriteString(string(node.Suggestion))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -0,0 +1,157 @@
+package typhoon
+
+// CommandExecutor runs a command once its input was parsed.
+type CommandExecutor func(ctx *CommandContext)
+
+// parsedArgument is a node read from a command input.
+type parsedArgument struct {
+	node  *CommandNode
+	raw   string
+	value interface{}
+}
+
+// CommandContext is given to command executors. It holds the sender, the
+// input and the values read by the parsers of the arguments, by name.
+type CommandContext struct {
+	core      *Core
+	sender    CommandSender
+	input     string
+	args      []string
+	arguments map[string]interface{}
+	failed    bool
+}
+
+func newCommandContext(core *Core, sender CommandSender, input string, path []parsedArgument) *CommandContext {
+	ctx := &CommandContext{
+		core:      core,
+		sender:    sender,
+		input:     input,
+		args:      make([]string, len(path)),
+		arguments: make(map[string]interface{}, len(path)),
+	}
+	for i, argument := range path {
+		ctx.args[i] = argument.raw
+		if argument.node.Type == CommandNodeTypeArgument {
+			ctx.arguments[argument.node.Name] = argument.value
+		}
+	}
+	return ctx
+}
+
+func (ctx *CommandContext) GetSender() CommandSender {
+	return ctx.sender
+}
+
+// Fail sends the message to the sender in red and marks the command as
+// failed: the PostCommandEvent reports it and its cooldowns don't start.
+func (ctx *CommandContext) Fail(message string) {
+	ctx.failed = true
+	commandError(ctx.sender, message)
+}
+
+// GetInput returns the command as typed, without its leading slash.
+func (ctx *CommandContext) GetInput() string {
+	return ctx.input
+}
+
+// GetArgs returns the literals and arguments read, quoted strings being
+// unquoted and greedy phrases kept whole.
+func (ctx *CommandContext) GetArgs() []string {
+	return ctx.args
+}
+
+// Has reports whether the argument was given.
+func (ctx *CommandContext) Has(name string) bool {
+	_, ok := ctx.arguments[name]
+	return ok
+}
+
+// Get returns the value of an argument, or nil if it was not given.
+func (ctx *CommandContext) Get(name string) interface{} {
+	return ctx.arguments[name]
+}
+
+// GetInt returns the value of an integer argument, or 0.
+func (ctx *CommandContext) GetInt(name string) int {
+	switch value := ctx.arguments[name].(type) {
+	case int32:
+		return int(value)
+	case int:
+		return value
+	}
+	return 0
+}
+
+// GetDouble returns the value of a double or float argument, or 0.
+func (ctx *CommandContext) GetDouble(name string) float64 {
+	switch value := ctx.arguments[name].(type) {
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	}
+	return 0
+}
+
+func (ctx *CommandContext) GetBool(name string) bool {
+	value, _ := ctx.arguments[name].(bool)
+	return value
+}
+
+func (ctx *CommandContext) GetString(name string) string {
+	value, _ := ctx.arguments[name].(string)
+	return value
+}
+
+// GetPlayer returns the online player named by a string argument, or the
+// first player targeted by an entity argument, or nil.
+func (ctx *CommandContext) GetPlayer(name string) *Player {
+	switch value := ctx.arguments[name].(type) {
+	case *Player:
+		return value
+	case string:
+		return ctx.core.playerRegistry.GetPlayerByName(value)
+	case *EntitySelector:
+		if players := value.Select(ctx.core, ctx.sender); len(players) > 0 {
+			return players[0]
+		}
+	}
+	return nil
+}
+
+// GetPlayers returns the players targeted by an entity or game profile
+// argument.
+func (ctx *CommandContext) GetPlayers(name string) []*Player {
+	if selector, ok := ctx.arguments[name].(*EntitySelector); ok {
+		return selector.Select(ctx.core, ctx.sender)
+	}
+	if player := ctx.GetPlayer(name); player != nil {
+		return []*Player{player}
+	}
+	return []*Player{}
+}
+
+// GetProfiles returns the profiles targeted by a game_profile or entity
+// argument, or the profile of the name given by a string argument. Names
+// of offline players give their offline UUID.
+func (ctx *CommandContext) GetProfiles(name string) []GameProfile {
+	switch value := ctx.arguments[name].(type) {
+	case *EntitySelector:
+		return value.Profiles(ctx.core, ctx.sender)
+	case string:
+		return (&EntitySelector{Name: value}).Profiles(ctx.core, ctx.sender)
+	}
+	return []GameProfile{}
+}
+
+// GetCoordinates returns the value of a block_pos or vec3 argument, or nil.
+func (ctx *CommandContext) GetCoordinates(name string) *CommandCoordinates {
+	value, _ := ctx.arguments[name].(*CommandCoordinates)
+	return value
+}
+
+// GetColor returns the value of a color argument, or nil.
+func (ctx *CommandContext) GetColor(name string) *ChatColor {
+	value, _ := ctx.arguments[name].(*ChatColor)
+	return value
+}
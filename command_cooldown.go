@@ -0,0 +1,138 @@
+package typhoon
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CooldownBypassPermission exempts a sender from the command cooldowns.
+const CooldownBypassPermission = "typhoon.command.cooldown.bypass"
+
+const cooldownCleanupInterval = time.Minute
+
+// CommandCooldown is the time a sender waits between two runs of a
+// command. Message is sent to the sender running it too early, with
+// {remaining} replaced by the time left. When empty, the
+// commands.cooldown_message of the configuration is sent.
+type CommandCooldown struct {
+	Duration time.Duration
+	Message  string
+}
+
+// WithCooldown makes the senders wait between two runs of the node and its
+// children. Aliases of the node share its cooldown.
+func (node *CommandNode) WithCooldown(duration time.Duration, message string) *CommandNode {
+	node.Cooldown = &CommandCooldown{duration, message}
+	return node
+}
+
+type cooldownKey struct {
+	sender   string
+	cooldown *CommandCooldown
+}
+
+// commandCooldowns holds the time until which each sender waits before
+// running a command again. The per-sender limit of Commands.Cooldown is
+// stored with a nil cooldown.
+type commandCooldowns struct {
+	until       map[cooldownKey]time.Time
+	mutex       *sync.Mutex
+	lastCleanup time.Time
+}
+
+func newCommandCooldowns() *commandCooldowns {
+	return &commandCooldowns{
+		until:       make(map[cooldownKey]time.Time),
+		mutex:       &sync.Mutex{},
+		lastCleanup: time.Now(),
+	}
+}
+
+// running returns the first cooldown of the sender still running and the
+// time left, or nil.
+func (cooldowns *commandCooldowns) running(sender string, list []*CommandCooldown, now time.Time) (*CommandCooldown, time.Duration) {
+	cooldowns.mutex.Lock()
+	defer cooldowns.mutex.Unlock()
+
+	cooldowns.cleanup(now)
+	for _, cooldown := range list {
+		if until := cooldowns.until[cooldownKey{sender, cooldown}]; until.After(now) {
+			return cooldown, until.Sub(now)
+		}
+	}
+	return nil, 0
+}
+
+// start starts the cooldowns of the sender.
+func (cooldowns *commandCooldowns) start(sender string, list []*CommandCooldown, limit time.Duration, now time.Time) {
+	cooldowns.mutex.Lock()
+	defer cooldowns.mutex.Unlock()
+
+	for _, cooldown := range list {
+		duration := limit
+		if cooldown != nil {
+			duration = cooldown.Duration
+		}
+		cooldowns.until[cooldownKey{sender, cooldown}] = now.Add(duration)
+	}
+}
+
+func (cooldowns *commandCooldowns) cleanup(now time.Time) {
+	if now.Sub(cooldowns.lastCleanup) < cooldownCleanupInterval {
+		return
+	}
+	cooldowns.lastCleanup = now
+	for key, until := range cooldowns.until {
+		if !until.After(now) {
+			delete(cooldowns.until, key)
+		}
+	}
+}
+
+// formatCooldown returns the time left in seconds, rounded up to a tenth.
+func formatCooldown(remaining time.Duration) string {
+	tenths := (remaining + 100*time.Millisecond - 1) / (100 * time.Millisecond)
+	return strconv.FormatFloat(float64(tenths)/10, 'f', -1, 64) + "s"
+}
+
+// pathCooldowns returns the cooldowns of the nodes of the path.
+func pathCooldowns(path []parsedArgument) []*CommandCooldown {
+	var list []*CommandCooldown
+	for _, argument := range path {
+		if argument.node.Cooldown != nil {
+			list = append(list, argument.node.Cooldown)
+		}
+	}
+	return list
+}
+
+// checkCooldowns reports whether none of the cooldowns is running, or
+// tells the sender how long to wait. A nil cooldown stands for
+// Commands.Cooldown.
+func (c *Core) checkCooldowns(sender CommandSender, list []*CommandCooldown) bool {
+	if len(list) == 0 || sender.HasPermission(CooldownBypassPermission) {
+		return true
+	}
+	config := c.getConfig().Commands
+	cooldown, remaining := c.cooldowns.running(sender.GetName(), list, time.Now())
+	if remaining <= 0 {
+		return true
+	}
+	message := config.CooldownMessage
+	if cooldown != nil && cooldown.Message != "" {
+		message = cooldown.Message
+	}
+	commandError(sender, strings.Replace(message, "{remaining}", formatCooldown(remaining), -1))
+	return false
+}
+
+// startCooldowns starts the cooldowns once the command succeeded.
+func (c *Core) startCooldowns(sender CommandSender, list []*CommandCooldown) {
+	if len(list) == 0 || sender.HasPermission(CooldownBypassPermission) {
+		return
+	}
+	limit := time.Duration(c.getConfig().Commands.Cooldown) * time.Millisecond
+	c.cooldowns.start(sender.GetName(), list, limit, time.Now())
+}
@@ -0,0 +1,335 @@
+package typhoon
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	commandContextType     = reflect.TypeOf((*CommandContext)(nil))
+	commandPlayerType      = reflect.TypeOf((*Player)(nil))
+	commandPlayersType     = reflect.TypeOf([]*Player(nil))
+	commandCoordinatesType = reflect.TypeOf((*CommandCoordinates)(nil))
+	commandColorType       = reflect.TypeOf((*ChatColor)(nil))
+)
+
+// handlerArgument is a field of the arguments of a handler method.
+type handlerArgument struct {
+	field    int
+	name     string
+	optional bool
+	parser   CommandParser
+	suggest  SuggestionProvider
+	get      func(ctx *CommandContext, name string) reflect.Value
+}
+
+// commandName turns a Go name into a command name: "BanIp" becomes
+// "ban-ip".
+func commandName(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) && i > 0 {
+			previous := rune(name[i-1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) {
+				builder.WriteByte('-')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(r))
+	}
+	return builder.String()
+}
+
+// CommandsFromHandler returns the commands declared by the exported
+// methods of a handler taking a *CommandContext, and optionally a struct
+// of arguments:
+//
+//	func (h *Handler) Ban(ctx *t.CommandContext, args struct {
+//		Target string `command:"target,suggest=players"`
+//		Reason string `command:"reason,optional,greedy"`
+//	})
+//
+// The method name gives the literals of the command, "Whitelist_Add"
+// declaring /whitelist add. Each field is an argument, named by the first
+// value of its command tag or after the field, and parsed depending on
+// its type: int32 and int as integers, float64 and float32, bool, string,
+// *Player and []*Player as entities, *CommandCoordinates as a block
+// position and *ChatColor as a color. The other values of the tag are:
+//
+//	optional            the argument and the next ones may be left out
+//	min=N, max=N        bounds of a number
+//	quotable, greedy    a quoted string, or the rest of the input
+//	message             the rest of the input, as a chat message
+//	vec3                coordinates with decimals
+//	suggest=players     suggests the online players
+//
+// Fields tagged "-" are left out.
+func CommandsFromHandler(handler interface{}) ([]*CommandNode, error) {
+	value := reflect.ValueOf(handler)
+	typ := value.Type()
+	roots := make([]*CommandNode, 0)
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		if method.Type.NumIn() < 2 || method.Type.In(1) != commandContextType {
+			continue
+		}
+		if method.Type.NumIn() > 3 || method.Type.NumOut() != 0 {
+			return nil, fmt.Errorf("typhoon: command method %s must take a *CommandContext and a struct of arguments, and return nothing", method.Name)
+		}
+
+		var argsType reflect.Type
+		var args []handlerArgument
+		if method.Type.NumIn() == 3 {
+			argsType = method.Type.In(2)
+			if argsType.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("typhoon: arguments of command method %s must be a struct", method.Name)
+			}
+			var err error
+			args, err = handlerArguments(argsType)
+			if err != nil {
+				return nil, fmt.Errorf("typhoon: command method %s: %v", method.Name, err)
+			}
+		}
+
+		var node *CommandNode
+		roots, node = handlerLiterals(roots, strings.Split(method.Name, "_"))
+		if node.Execute != nil {
+			return nil, fmt.Errorf("typhoon: command method %s is declared twice", method.Name)
+		}
+		execute := handlerExecutor(value.Method(i), argsType, args)
+		if len(args) == 0 || args[0].optional {
+			node.Execute = execute
+		}
+		for j, arg := range args {
+			child := CommandNodeArgument(arg.name, nil, arg.parser, nil)
+			child.Suggestions = arg.suggest
+			if j == len(args)-1 || args[j+1].optional {
+				child.Execute = execute
+			}
+			node.Children = append(node.Children, child)
+			node = child
+		}
+	}
+	return roots, nil
+}
+
+// handlerLiterals returns the literal declared by the names, creating the
+// missing ones.
+func handlerLiterals(roots []*CommandNode, names []string) ([]*CommandNode, *CommandNode) {
+	var node *CommandNode
+	children := &roots
+	for _, name := range names {
+		name = commandName(name)
+		var found *CommandNode
+		for _, child := range *children {
+			if child.Type == CommandNodeTypeLiteral && child.Name == name {
+				found = child
+				break
+			}
+		}
+		if found == nil {
+			found = CommandNodeLiteral(name, nil, nil)
+			*children = append(*children, found)
+		}
+		node = found
+		children = &node.Children
+	}
+	return roots, node
+}
+
+// handlerArguments reads the arguments from the fields of a struct.
+func handlerArguments(typ reflect.Type) ([]handlerArgument, error) {
+	args := make([]handlerArgument, 0, typ.NumField())
+	names := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("command")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		values := strings.Split(tag, ",")
+		arg := handlerArgument{
+			field: i,
+			name:  values[0],
+		}
+		if arg.name == "" {
+			arg.name = commandName(field.Name)
+		}
+		if names[arg.name] {
+			return nil, fmt.Errorf("argument %s is declared twice", arg.name)
+		}
+		names[arg.name] = true
+
+		options := make(map[string]string)
+		for _, option := range values[1:] {
+			key := strings.SplitN(option, "=", 2)
+			switch key[0] {
+			case "optional", "quotable", "greedy", "message", "vec3":
+				options[key[0]] = ""
+			case "min", "max", "suggest":
+				if len(key) != 2 {
+					return nil, fmt.Errorf("option %s of argument %s needs a value", key[0], arg.name)
+				}
+				options[key[0]] = key[1]
+			default:
+				return nil, fmt.Errorf("unknown option %s of argument %s", key[0], arg.name)
+			}
+		}
+		_, arg.optional = options["optional"]
+		if !arg.optional && len(args) > 0 && args[len(args)-1].optional {
+			return nil, fmt.Errorf("argument %s follows an optional argument", arg.name)
+		}
+		if len(args) > 0 {
+			if parser, ok := args[len(args)-1].parser.(*CommandParserString); ok && parser.Format == CommandParserStringFormatGreedyPhrase {
+				return nil, fmt.Errorf("argument %s follows a greedy argument", arg.name)
+			}
+			if _, ok := args[len(args)-1].parser.(*CommandParserMessage); ok {
+				return nil, fmt.Errorf("argument %s follows a message argument", arg.name)
+			}
+		}
+		switch options["suggest"] {
+		case "":
+		case "players":
+			arg.suggest = SuggestPlayers
+		default:
+			return nil, fmt.Errorf("unknown suggestions %s of argument %s", options["suggest"], arg.name)
+		}
+
+		var err error
+		arg.parser, arg.get, err = handlerParser(field.Type, options)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", arg.name, err)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// handlerParser infers the parser of an argument from its type, and
+// returns the way to read its value from the context.
+func handlerParser(typ reflect.Type, options map[string]string) (CommandParser, func(ctx *CommandContext, name string) reflect.Value, error) {
+	_, hasMin := options["min"]
+	_, hasMax := options["max"]
+	if (hasMin || hasMax) && typ.Kind() != reflect.Int32 && typ.Kind() != reflect.Int &&
+		typ.Kind() != reflect.Float64 && typ.Kind() != reflect.Float32 {
+		return nil, nil, fmt.Errorf("min and max only apply to numbers")
+	}
+
+	switch typ.Kind() {
+	case reflect.Int32, reflect.Int:
+		parser := &CommandParserInteger{}
+		for key, bound := range map[string]*OptInteger{"min": &parser.Min, "max": &parser.Max} {
+			if value, ok := options[key]; ok {
+				n, err := strconv.ParseInt(value, 10, 32)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid %s %q", key, value)
+				}
+				*bound = OptInteger{true, int32(n)}
+			}
+		}
+		return parser, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetInt(name)).Convert(typ)
+		}, nil
+	case reflect.Float64:
+		parser := &CommandParserDouble{}
+		for key, bound := range map[string]*OptDouble{"min": &parser.Min, "max": &parser.Max} {
+			if value, ok := options[key]; ok {
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid %s %q", key, value)
+				}
+				*bound = OptDouble{true, n}
+			}
+		}
+		return parser, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetDouble(name)).Convert(typ)
+		}, nil
+	case reflect.Float32:
+		parser := &CommandParserFloat{}
+		for key, bound := range map[string]*OptFloat{"min": &parser.Min, "max": &parser.Max} {
+			if value, ok := options[key]; ok {
+				n, err := strconv.ParseFloat(value, 32)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid %s %q", key, value)
+				}
+				*bound = OptFloat{true, float32(n)}
+			}
+		}
+		return parser, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetDouble(name)).Convert(typ)
+		}, nil
+	case reflect.Bool:
+		return &CommandParserBool{}, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetBool(name)).Convert(typ)
+		}, nil
+	case reflect.String:
+		var parser CommandParser = &CommandParserString{Format: CommandParserStringFormatSingleWord}
+		if _, ok := options["quotable"]; ok {
+			parser = &CommandParserString{Format: CommandParserStringFormatQuotablePhrase}
+		} else if _, ok := options["greedy"]; ok {
+			parser = &CommandParserString{Format: CommandParserStringFormatGreedyPhrase}
+		} else if _, ok := options["message"]; ok {
+			parser = &CommandParserMessage{}
+		}
+		return parser, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetString(name)).Convert(typ)
+		}, nil
+	}
+
+	switch typ {
+	case commandPlayerType:
+		return &CommandParserEntity{Single: true, PlayersOnly: true}, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetPlayer(name))
+		}, nil
+	case commandPlayersType:
+		return &CommandParserEntity{PlayersOnly: true}, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetPlayers(name))
+		}, nil
+	case commandCoordinatesType:
+		var parser CommandParser = &CommandParserBlockPos{}
+		if _, ok := options["vec3"]; ok {
+			parser = &CommandParserVec3{}
+		}
+		return parser, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetCoordinates(name))
+		}, nil
+	case commandColorType:
+		return &CommandParserColor{}, func(ctx *CommandContext, name string) reflect.Value {
+			return reflect.ValueOf(ctx.GetColor(name))
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// handlerExecutor calls the method with the arguments read from the
+// context, those left out keeping their zero value.
+func handlerExecutor(method reflect.Value, argsType reflect.Type, args []handlerArgument) CommandExecutor {
+	return func(ctx *CommandContext) {
+		in := []reflect.Value{reflect.ValueOf(ctx)}
+		if argsType != nil {
+			values := reflect.New(argsType).Elem()
+			for _, arg := range args {
+				if ctx.Has(arg.name) {
+					values.Field(arg.field).Set(arg.get(ctx, arg.name))
+				}
+			}
+			in = append(in, values)
+		}
+		method.Call(in)
+	}
+}
+
+// DeclareHandler declares the commands of a handler, see
+// CommandsFromHandler.
+func (c *Core) DeclareHandler(handler interface{}) error {
+	commands, err := CommandsFromHandler(handler)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		c.DeclareCommand(command)
+	}
+	return nil
+}
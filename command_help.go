@@ -0,0 +1,164 @@
+package typhoon
+
+import (
+	"sort"
+	"strings"
+)
+
+// usageText returns the name of a literal, or <name> for an argument.
+func (node *CommandNode) usageText() string {
+	if node.Type == CommandNodeTypeArgument {
+		return "<" + node.Name + ">"
+	}
+	return node.Name
+}
+
+// usableChildren returns the children the sender can use.
+func (node *CommandNode) usableChildren(sender CommandSender) []*CommandNode {
+	children := make([]*CommandNode, 0, len(node.Children))
+	for _, child := range node.Children {
+		if child.canUse(sender) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// commandUsage returns the usage of the node, optional arguments being
+// between brackets and alternatives between parentheses, the way vanilla
+// /help renders it. A deep usage leaves out the children.
+func (c *Core) commandUsage(sender CommandSender, node *CommandNode, optional bool, deep bool) string {
+	usage := node.usageText()
+	if optional {
+		usage = "[" + usage + "]"
+	}
+	if deep {
+		return usage
+	}
+	return usage + c.commandUsageSuffix(sender, node)
+}
+
+// commandUsageSuffix returns what follows the node in its usage: its
+// redirection or the usage of its children.
+func (c *Core) commandUsageSuffix(sender CommandSender, node *CommandNode) string {
+	if node.RedirectNode == &c.rootCommand {
+		return " ..."
+	}
+	if node.RedirectNode != nil {
+		return " -> " + node.RedirectNode.usageText()
+	}
+	optional := node.Execute != nil
+	children := node.usableChildren(sender)
+	if len(children) == 1 {
+		return " " + c.commandUsage(sender, children[0], optional, optional)
+	}
+	if len(children) == 0 {
+		return ""
+	}
+	usages := make([]string, 0, len(children))
+	seen := make(map[string]bool)
+	for _, child := range children {
+		usage := c.commandUsage(sender, child, false, true)
+		if !seen[usage] {
+			seen[usage] = true
+			usages = append(usages, usage)
+		}
+	}
+	if len(usages) == 1 && optional {
+		return " [" + usages[0] + "]"
+	} else if len(usages) == 1 {
+		return " " + usages[0]
+	} else if optional {
+		return " [" + strings.Join(usages, "|") + "]"
+	}
+	return " (" + strings.Join(usages, "|") + ")"
+}
+
+// resolveCommand returns the node reached by the whole input, executable or
+// not, or nil when the input matches no node the sender can use.
+func (c *Core) resolveCommand(sender CommandSender, reader *StringReader, node *CommandNode) *CommandNode {
+	reader.SkipWhitespace()
+	if !reader.CanRead() {
+		return node
+	}
+	start := reader.GetCursor()
+	for _, child := range node.redirected().usableChildren(sender) {
+		reader.SetCursor(start)
+		_, err := child.parse(reader)
+		if err == nil && (!reader.CanRead() || reader.Peek() == ' ') {
+			if found := c.resolveCommand(sender, reader, child); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// commandHelpLine is a usage listed by /help, and the command it suggests
+// when clicked.
+type commandHelpLine struct {
+	usage   string
+	suggest string
+}
+
+// commandHelp returns the usage lines of the commands the sender can use,
+// or of the children of the command given.
+func (c *Core) commandHelp(sender CommandSender, command string) ([]commandHelpLine, bool) {
+	c.commandMutex.RLock()
+	defer c.commandMutex.RUnlock()
+	lines := make([]commandHelpLine, 0)
+	if command == "" {
+		for _, child := range c.rootCommand.usableChildren(sender) {
+			lines = append(lines, commandHelpLine{"/" + c.commandUsage(sender, child, false, false), "/" + child.Name})
+		}
+		sort.Slice(lines, func(i, j int) bool {
+			return lines[i].usage < lines[j].usage
+		})
+		return lines, true
+	}
+
+	node := c.resolveCommand(sender, NewStringReader(command), &c.rootCommand)
+	if node == nil || node == &c.rootCommand {
+		return nil, false
+	}
+	if node.RedirectNode == nil {
+		optional := node.Execute != nil
+		for _, child := range node.usableChildren(sender) {
+			lines = append(lines, commandHelpLine{"/" + command + " " + c.commandUsage(sender, child, optional, false), "/" + command + " "})
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, commandHelpLine{"/" + command + c.commandUsageSuffix(sender, node), "/" + command})
+	}
+	return lines, true
+}
+
+// suggestCommands completes the command given to /help.
+func suggestCommands(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+	start, suggestions := core.completeCommand(sender, arg)
+	for i := range suggestions {
+		suggestions[i].Text = arg[:start] + suggestions[i].Text
+	}
+	return suggestions
+}
+
+// HelpCommand returns the /help [command] command, listing the usage of
+// the commands the sender can use. Clicking a usage suggests the command.
+func (c *Core) HelpCommand() *CommandNode {
+	execute := func(ctx *CommandContext) {
+		command := strings.TrimSpace(ctx.GetString("command"))
+		lines, ok := c.commandHelp(ctx.GetSender(), command)
+		if !ok {
+			ctx.Fail("Unknown command or insufficient permissions")
+			return
+		}
+		for _, line := range lines {
+			m := ChatMessage(line.usage)
+			m.SetClickEvent(ChatClickSuggestCommand(line.suggest))
+			ctx.GetSender().SendMessage(m)
+		}
+	}
+	return CommandNodeLiteral("help", []*CommandNode{
+		CommandNodeArgument("command", nil, &CommandParserString{Format: CommandParserStringFormatGreedyPhrase}, execute).Suggest(suggestCommands),
+	}, execute)
+}
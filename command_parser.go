@@ -1,8 +1,6 @@
 package typhoon
 
 import (
-	"log"
-	"strconv"
 	"strings"
 )
 
@@ -26,14 +24,8 @@ type CommandParserBool struct{}
 func (c *CommandParserBool) GetId() string {
 	return "brigadier:bool"
 }
-func (c *CommandParserBool) IsMultiple() bool {
-	return false
-}
-func (c *CommandParserBool) IsValid(arg string) bool {
-	return arg == "true" || arg == "false"
-}
-func (c *CommandParserBool) IsArrayValid(arg []string) bool {
-	return false
+func (c *CommandParserBool) Parse(reader *StringReader) (interface{}, error) {
+	return reader.ReadBoolean()
 }
 func (c *CommandParserBool) Complete(arg string) []string {
 	ans := make([]string, 0)
@@ -60,24 +52,19 @@ type CommandParserDouble struct {
 func (c *CommandParserDouble) GetId() string {
 	return "brigadier:double"
 }
-func (c *CommandParserDouble) IsMultiple() bool {
-	return false
-}
-func (c *CommandParserDouble) IsValid(arg string) bool {
-	nb, err := strconv.ParseFloat(arg, 64)
+func (c *CommandParserDouble) Parse(reader *StringReader) (interface{}, error) {
+	start := reader.GetCursor()
+	nb, err := reader.ReadDouble()
 	if err != nil {
-		return false
+		return nil, err
 	}
 	if c.Min.Used && c.Min.Value > nb {
-		return false
+		return nil, reader.errorAt(start, "Double must not be less than %s, found %s", formatFloat(c.Min.Value), formatFloat(nb))
 	}
 	if c.Max.Used && c.Max.Value < nb {
-		return false
+		return nil, reader.errorAt(start, "Double must not be more than %s, found %s", formatFloat(c.Max.Value), formatFloat(nb))
 	}
-	return true
-}
-func (c *CommandParserDouble) IsArrayValid(arg []string) bool {
-	return false
+	return nb, nil
 }
 func (c *CommandParserDouble) Complete(arg string) []string {
 	return []string{arg}
@@ -95,20 +82,20 @@ func (c *CommandParserDouble) writeProperties(player *Player) (err error) {
 	}
 	err = player.WriteUInt8(flags)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if c.Min.Used {
 		err = player.WriteFloat64(c.Min.Value)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if c.Max.Used {
 		err = player.WriteFloat64(c.Max.Value)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -123,24 +110,19 @@ type CommandParserFloat struct {
 func (c *CommandParserFloat) GetId() string {
 	return "brigadier:float"
 }
-func (c *CommandParserFloat) IsMultiple() bool {
-	return false
-}
-func (c *CommandParserFloat) IsValid(arg string) bool {
-	nb, err := strconv.ParseFloat(arg, 32)
+func (c *CommandParserFloat) Parse(reader *StringReader) (interface{}, error) {
+	start := reader.GetCursor()
+	nb, err := reader.ReadFloat()
 	if err != nil {
-		return false
+		return nil, err
 	}
-	if c.Min.Used && c.Min.Value > float32(nb) {
-		return false
+	if c.Min.Used && c.Min.Value > nb {
+		return nil, reader.errorAt(start, "Float must not be less than %s, found %s", formatFloat(float64(c.Min.Value)), formatFloat(float64(nb)))
 	}
-	if c.Max.Used && c.Max.Value < float32(nb) {
-		return false
+	if c.Max.Used && c.Max.Value < nb {
+		return nil, reader.errorAt(start, "Float must not be more than %s, found %s", formatFloat(float64(c.Max.Value)), formatFloat(float64(nb)))
 	}
-	return true
-}
-func (c *CommandParserFloat) IsArrayValid(arg []string) bool {
-	return false
+	return nb, nil
 }
 func (c *CommandParserFloat) Complete(arg string) []string {
 	return []string{arg}
@@ -158,20 +140,20 @@ func (c *CommandParserFloat) writeProperties(player *Player) (err error) {
 	}
 	err = player.WriteUInt8(flags)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if c.Min.Used {
 		err = player.WriteFloat32(c.Min.Value)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if c.Max.Used {
 		err = player.WriteFloat32(c.Max.Value)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -186,24 +168,19 @@ type CommandParserInteger struct {
 func (c *CommandParserInteger) GetId() string {
 	return "brigadier:integer"
 }
-func (c *CommandParserInteger) IsMultiple() bool {
-	return false
-}
-func (c *CommandParserInteger) IsValid(arg string) bool {
-	nb, err := strconv.ParseInt(arg, 10, 32)
+func (c *CommandParserInteger) Parse(reader *StringReader) (interface{}, error) {
+	start := reader.GetCursor()
+	nb, err := reader.ReadInt()
 	if err != nil {
-		return false
+		return nil, err
 	}
-	if c.Min.Used && c.Min.Value > int32(nb) {
-		return false
+	if c.Min.Used && c.Min.Value > nb {
+		return nil, reader.errorAt(start, "Integer must not be less than %d, found %d", c.Min.Value, nb)
 	}
-	if c.Max.Used && c.Max.Value < int32(nb) {
-		return false
+	if c.Max.Used && c.Max.Value < nb {
+		return nil, reader.errorAt(start, "Integer must not be more than %d, found %d", c.Max.Value, nb)
 	}
-	return true
-}
-func (c *CommandParserInteger) IsArrayValid(arg []string) bool {
-	return false
+	return nb, nil
 }
 func (c *CommandParserInteger) Complete(arg string) []string {
 	return []string{arg}
@@ -221,20 +198,20 @@ func (c *CommandParserInteger) writeProperties(player *Player) (err error) {
 	}
 	err = player.WriteUInt8(flags)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if c.Min.Used {
 		err = player.WriteUInt32(uint32(c.Min.Value))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if c.Max.Used {
 		err = player.WriteUInt32(uint32(c.Max.Value))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -245,8 +222,8 @@ type CommandParserStringFormat int
 
 const (
 	CommandParserStringFormatSingleWord     CommandParserStringFormat = iota
-	commandParserStringFormatQuotablePhrase                           //TODO
-	CommandParserStringFormatGreedyPhrase
+	CommandParserStringFormatQuotablePhrase                           // a word, or a quoted string
+	CommandParserStringFormatGreedyPhrase                             // the rest of the input
 )
 
 type CommandParserString struct {
@@ -256,14 +233,16 @@ type CommandParserString struct {
 func (c *CommandParserString) GetId() string {
 	return "brigadier:string"
 }
-func (c *CommandParserString) IsMultiple() bool {
-	return c.Format != CommandParserStringFormatSingleWord
-}
-func (c *CommandParserString) IsValid(arg string) bool {
-	return true
-}
-func (c *CommandParserString) IsArrayValid(arg []string) bool {
-	return true
+func (c *CommandParserString) Parse(reader *StringReader) (interface{}, error) {
+	switch c.Format {
+	case CommandParserStringFormatQuotablePhrase:
+		return reader.ReadString()
+	case CommandParserStringFormatGreedyPhrase:
+		text := reader.GetRemaining()
+		reader.SetCursor(len(reader.GetString()))
+		return text, nil
+	}
+	return reader.ReadUnquotedString(), nil
 }
 func (c *CommandParserString) Complete(arg string) []string {
 	return []string{arg}
@@ -274,7 +253,7 @@ func (c *CommandParserString) GetSuggestion() CommandSuggestionType {
 func (c *CommandParserString) writeProperties(player *Player) (err error) {
 	err = player.WriteVarInt(int(c.Format))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -0,0 +1,552 @@
+package typhoon
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/TyphoonMC/go.uuid"
+)
+
+// EntitySelector is a player name or UUID, or a target selector such as
+// @a[limit=3]. It is resolved against the online players when the command
+// runs, as this server has no other entity.
+type EntitySelector struct {
+	Kind         byte   // 'a', 'e', 'p', 'r', 's', or 0 for a name or UUID
+	Name         string // player name or UUID when Kind is 0
+	Limit        int    // 0 for no limit
+	NameFilter   string // name= option
+	NameExcluded bool   // name=! option
+}
+
+// Select returns the players targeted by the selector for the sender.
+func (selector *EntitySelector) Select(core *Core, sender CommandSender) []*Player {
+	registry := core.playerRegistry
+	players := make([]*Player, 0)
+	switch selector.Kind {
+	case 0:
+		player := registry.GetPlayerByName(selector.Name)
+		if player == nil {
+			player = registry.GetPlayerByUUID(strings.ToLower(selector.Name))
+		}
+		if player != nil {
+			players = append(players, player)
+		}
+		return players
+	case 's':
+		if player, ok := sender.(*Player); ok {
+			players = append(players, player)
+		}
+	case 'p':
+		if player, ok := sender.(*Player); ok {
+			players = append(players, player)
+		} else {
+			players = registry.GetPlayers()
+		}
+	case 'r':
+		players = registry.GetPlayers()
+		rand.Shuffle(len(players), func(i, j int) {
+			players[i], players[j] = players[j], players[i]
+		})
+	default:
+		players = registry.GetPlayers()
+	}
+
+	if selector.NameFilter != "" {
+		filtered := players[:0]
+		for _, player := range players {
+			if strings.EqualFold(player.name, selector.NameFilter) != selector.NameExcluded {
+				filtered = append(filtered, player)
+			}
+		}
+		players = filtered
+	}
+	if selector.Limit > 0 && len(players) > selector.Limit {
+		players = players[:selector.Limit]
+	}
+	return players
+}
+
+// GameProfile is the UUID and name of a player, online or not.
+type GameProfile struct {
+	UUID string
+	Name string
+}
+
+// Profiles returns the profiles targeted by the selector for the sender.
+// A name or UUID matching no online player gives an offline profile, its
+// name being empty for a UUID.
+func (selector *EntitySelector) Profiles(core *Core, sender CommandSender) []GameProfile {
+	players := selector.Select(core, sender)
+	profiles := make([]GameProfile, 0, len(players))
+	for _, player := range players {
+		profiles = append(profiles, GameProfile{player.uuid, player.name})
+	}
+	if len(profiles) > 0 || selector.Kind != 0 {
+		return profiles
+	}
+	if uid, err := uuid.FromString(selector.Name); err == nil {
+		return append(profiles, GameProfile{uid.String(), ""})
+	}
+	return append(profiles, GameProfile{OfflineUUID(selector.Name), selector.Name})
+}
+
+func (selector *EntitySelector) single() bool {
+	return selector.Kind == 0 || selector.Limit == 1
+}
+
+func parseEntitySelector(reader *StringReader) (*EntitySelector, error) {
+	start := reader.GetCursor()
+	if !reader.CanRead() || reader.Peek() != '@' {
+		name := reader.ReadUnquotedString()
+		if name == "" {
+			return nil, reader.Errorf("Invalid name or UUID")
+		}
+		return &EntitySelector{Name: name}, nil
+	}
+
+	reader.Skip()
+	if !reader.CanRead() {
+		return nil, reader.Errorf("Missing selector type")
+	}
+	selector := &EntitySelector{Kind: reader.Read()}
+	switch selector.Kind {
+	case 'p', 'r', 's':
+		selector.Limit = 1
+	case 'a', 'e':
+	default:
+		return nil, reader.errorAt(start, "Unknown selector type '%s'", reader.GetString()[start:reader.GetCursor()])
+	}
+	if !reader.CanRead() || reader.Peek() != '[' {
+		return selector, nil
+	}
+	reader.Skip()
+	reader.SkipWhitespace()
+	for reader.CanRead() && reader.Peek() != ']' {
+		optionStart := reader.GetCursor()
+		option, err := reader.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		reader.SkipWhitespace()
+		if err := reader.Expect('='); err != nil {
+			return nil, reader.Errorf("Expected value for option '%s'", option)
+		}
+		reader.SkipWhitespace()
+		switch option {
+		case "limit":
+			limitStart := reader.GetCursor()
+			limit, err := reader.ReadInt()
+			if err != nil {
+				return nil, err
+			}
+			if limit < 1 {
+				return nil, reader.errorAt(limitStart, "Limit must be at least 1")
+			}
+			selector.Limit = int(limit)
+		case "name":
+			if reader.CanRead() && reader.Peek() == '!' {
+				reader.Skip()
+				selector.NameExcluded = true
+			}
+			if selector.NameFilter, err = reader.ReadString(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, reader.errorAt(optionStart, "Unknown option '%s'", option)
+		}
+		reader.SkipWhitespace()
+		if reader.CanRead() && reader.Peek() == ',' {
+			reader.Skip()
+			reader.SkipWhitespace()
+		} else if !reader.CanRead() || reader.Peek() != ']' {
+			return nil, reader.Errorf("Expected end of options")
+		}
+	}
+	if err := reader.Expect(']'); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// suggestEntitySelector suggests the selectors and the online players.
+func suggestEntitySelector(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+	suggestions := SuggestPlayers(core, sender, arg)
+	for _, selector := range completeEntitySelector(arg) {
+		suggestions = append(suggestions, CommandSuggestion{Text: selector})
+	}
+	return suggestions
+}
+
+func completeEntitySelector(arg string) []string {
+	ans := make([]string, 0)
+	for _, selector := range []string{"@a", "@e", "@p", "@r", "@s"} {
+		if strings.HasPrefix(selector, arg) {
+			ans = append(ans, selector)
+		}
+	}
+	return ans
+}
+
+// CommandParserEntity reads a player name, a UUID or a target selector,
+// producing an *EntitySelector.
+type CommandParserEntity struct {
+	Single      bool
+	PlayersOnly bool
+}
+
+func (c *CommandParserEntity) GetId() string {
+	return "minecraft:entity"
+}
+func (c *CommandParserEntity) Parse(reader *StringReader) (interface{}, error) {
+	start := reader.GetCursor()
+	selector, err := parseEntitySelector(reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.Single && !selector.single() {
+		if c.PlayersOnly {
+			return nil, reader.errorAt(start, "Only one player is allowed, but the provided selector allows more than one")
+		}
+		return nil, reader.errorAt(start, "Only one entity is allowed, but the provided selector allows more than one")
+	}
+	if c.PlayersOnly && selector.Kind == 'e' {
+		return nil, reader.errorAt(start, "Only players may be affected by this command, but the provided selector includes entities")
+	}
+	return selector, nil
+}
+func (c *CommandParserEntity) Complete(arg string) []string {
+	return completeEntitySelector(arg)
+}
+func (c *CommandParserEntity) Suggest(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+	return suggestEntitySelector(core, sender, arg)
+}
+func (c *CommandParserEntity) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserEntity) writeProperties(player *Player) (err error) {
+	flags := uint8(0)
+	if c.Single {
+		flags |= 0x01
+	}
+	if c.PlayersOnly {
+		flags |= 0x02
+	}
+	err = player.WriteUInt8(flags)
+	if err != nil {
+		player.protocolError(err)
+		return
+	}
+	return
+}
+
+// CommandParserGameProfile reads player names, UUIDs or selectors,
+// producing an *EntitySelector. Unlike entities, names of offline players
+// are allowed, see CommandContext.GetProfiles.
+type CommandParserGameProfile struct{}
+
+func (c *CommandParserGameProfile) GetId() string {
+	return "minecraft:game_profile"
+}
+func (c *CommandParserGameProfile) Parse(reader *StringReader) (interface{}, error) {
+	return parseEntitySelector(reader)
+}
+func (c *CommandParserGameProfile) Complete(arg string) []string {
+	return completeEntitySelector(arg)
+}
+func (c *CommandParserGameProfile) Suggest(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+	return suggestEntitySelector(core, sender, arg)
+}
+func (c *CommandParserGameProfile) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserGameProfile) writeProperties(player *Player) (err error) {
+	return
+}
+
+// CommandCoordinate is an absolute coordinate, or an offset when Relative.
+type CommandCoordinate struct {
+	Value    float64
+	Relative bool
+}
+
+func (coordinate CommandCoordinate) resolve(origin float64) float64 {
+	if coordinate.Relative {
+		return origin + coordinate.Value
+	}
+	return coordinate.Value
+}
+
+// CommandCoordinates are the coordinates read by the block_pos and vec3
+// parsers. Local coordinates (^left ^up ^forwards) are offsets along the
+// rotation of the origin, others are absolute or relative (~) to it.
+type CommandCoordinates struct {
+	X     CommandCoordinate
+	Y     CommandCoordinate
+	Z     CommandCoordinate
+	Local bool
+}
+
+// Resolve returns the position for an origin and its rotation, in degrees.
+func (coordinates *CommandCoordinates) Resolve(x, y, z float64, yaw, pitch float32) (float64, float64, float64) {
+	if !coordinates.Local {
+		return coordinates.X.resolve(x), coordinates.Y.resolve(y), coordinates.Z.resolve(z)
+	}
+	rad := math.Pi / 180
+	f := math.Cos((float64(yaw) + 90) * rad)
+	f1 := math.Sin((float64(yaw) + 90) * rad)
+	f2 := math.Cos(-float64(pitch) * rad)
+	f3 := math.Sin(-float64(pitch) * rad)
+	f4 := math.Cos((-float64(pitch) + 90) * rad)
+	f5 := math.Sin((-float64(pitch) + 90) * rad)
+	forward := [3]float64{f * f2, f3, f1 * f2}
+	up := [3]float64{f * f4, f5, f1 * f4}
+	left := [3]float64{
+		-(forward[1]*up[2] - forward[2]*up[1]),
+		-(forward[2]*up[0] - forward[0]*up[2]),
+		-(forward[0]*up[1] - forward[1]*up[0]),
+	}
+	l, u, fw := coordinates.X.Value, coordinates.Y.Value, coordinates.Z.Value
+	return x + forward[0]*fw + up[0]*u + left[0]*l,
+		y + forward[1]*fw + up[1]*u + left[1]*l,
+		z + forward[2]*fw + up[2]*u + left[2]*l
+}
+
+// ResolveBlock returns the block containing the resolved position.
+func (coordinates *CommandCoordinates) ResolveBlock(x, y, z float64, yaw, pitch float32) Position {
+	rx, ry, rz := coordinates.Resolve(x, y, z, yaw, pitch)
+	return Position{int(math.Floor(rx)), int(math.Floor(ry)), int(math.Floor(rz))}
+}
+
+// readCoordinate reads a coordinate prefixed by the given relative marker.
+// Absolute block coordinates must be integers, absolute vec3 ones without
+// a decimal point are centered on the block when centered is set.
+func readCoordinate(reader *StringReader, marker byte, integer bool, centered bool) (CommandCoordinate, error) {
+	coordinate := CommandCoordinate{}
+	if !reader.CanRead() {
+		return coordinate, reader.Errorf("Expected a coordinate")
+	}
+	if reader.Peek() == marker {
+		reader.Skip()
+		coordinate.Relative = true
+		if !reader.CanRead() || reader.Peek() == ' ' {
+			return coordinate, nil
+		}
+		value, err := reader.ReadDouble()
+		coordinate.Value = value
+		return coordinate, err
+	}
+	if marker == '^' {
+		return coordinate, reader.Errorf("Cannot mix world & local coordinates (everything must either use ^ or not)")
+	}
+	if integer {
+		value, err := reader.ReadInt()
+		coordinate.Value = float64(value)
+		return coordinate, err
+	}
+	start := reader.GetCursor()
+	value, err := reader.ReadDouble()
+	if err == nil && centered && !strings.Contains(reader.GetString()[start:reader.GetCursor()], ".") {
+		value += 0.5
+	}
+	coordinate.Value = value
+	return coordinate, err
+}
+
+func readCoordinates(reader *StringReader, integer bool) (*CommandCoordinates, error) {
+	start := reader.GetCursor()
+	coordinates := &CommandCoordinates{}
+	marker := byte('~')
+	if reader.CanRead() && reader.Peek() == '^' {
+		marker = '^'
+		coordinates.Local = true
+	}
+	targets := []*CommandCoordinate{&coordinates.X, &coordinates.Y, &coordinates.Z}
+	for i, target := range targets {
+		if i > 0 {
+			if !reader.CanRead() || reader.Peek() != ' ' {
+				return nil, reader.errorAt(start, "Incomplete (expected 3 coordinates)")
+			}
+			reader.Skip()
+		}
+		if !coordinates.Local && reader.CanRead() && reader.Peek() == '^' {
+			return nil, reader.Errorf("Cannot mix world & local coordinates (everything must either use ^ or not)")
+		}
+		coordinate, err := readCoordinate(reader, marker, integer, i != 1)
+		if err != nil {
+			return nil, err
+		}
+		*target = coordinate
+	}
+	return coordinates, nil
+}
+
+func completeCoordinates(arg string) []string {
+	if arg == "" {
+		return []string{"~", "^"}
+	}
+	return []string{arg}
+}
+
+// CommandParserBlockPos reads block coordinates, producing
+// *CommandCoordinates.
+type CommandParserBlockPos struct{}
+
+func (c *CommandParserBlockPos) GetId() string {
+	return "minecraft:block_pos"
+}
+func (c *CommandParserBlockPos) Parse(reader *StringReader) (interface{}, error) {
+	return readCoordinates(reader, true)
+}
+func (c *CommandParserBlockPos) Complete(arg string) []string {
+	return completeCoordinates(arg)
+}
+func (c *CommandParserBlockPos) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserBlockPos) writeProperties(player *Player) (err error) {
+	return
+}
+
+// CommandParserVec3 reads a position, producing *CommandCoordinates.
+type CommandParserVec3 struct{}
+
+func (c *CommandParserVec3) GetId() string {
+	return "minecraft:vec3"
+}
+func (c *CommandParserVec3) Parse(reader *StringReader) (interface{}, error) {
+	return readCoordinates(reader, false)
+}
+func (c *CommandParserVec3) Complete(arg string) []string {
+	return completeCoordinates(arg)
+}
+func (c *CommandParserVec3) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserVec3) writeProperties(player *Player) (err error) {
+	return
+}
+
+// CommandParserMessage reads the rest of the input as a chat message.
+type CommandParserMessage struct{}
+
+func (c *CommandParserMessage) GetId() string {
+	return "minecraft:message"
+}
+func (c *CommandParserMessage) Parse(reader *StringReader) (interface{}, error) {
+	text := reader.GetRemaining()
+	reader.SetCursor(len(reader.GetString()))
+	return text, nil
+}
+func (c *CommandParserMessage) Complete(arg string) []string {
+	return []string{arg}
+}
+func (c *CommandParserMessage) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserMessage) writeProperties(player *Player) (err error) {
+	return
+}
+
+// CommandParserColor reads a chat color name, producing a *ChatColor.
+type CommandParserColor struct{}
+
+func (c *CommandParserColor) GetId() string {
+	return "minecraft:color"
+}
+func (c *CommandParserColor) Parse(reader *StringReader) (interface{}, error) {
+	start := reader.GetCursor()
+	name := reader.ReadUnquotedString()
+	for i := range chatColorIds {
+		if chatColorIds[i].name == name {
+			return &chatColorIds[i], nil
+		}
+	}
+	return nil, reader.errorAt(start, "Unknown color '%s'", name)
+}
+func (c *CommandParserColor) Complete(arg string) []string {
+	ans := make([]string, 0)
+	for _, color := range chatColorIds {
+		if strings.HasPrefix(color.name, arg) {
+			ans = append(ans, color.name)
+		}
+	}
+	return ans
+}
+func (c *CommandParserColor) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserColor) writeProperties(player *Player) (err error) {
+	return
+}
+
+// scanJSON returns the length of the JSON value at the start of the input,
+// or 0 if it is unterminated.
+func scanJSON(input string) int {
+	depth := 0
+	inString := false
+	escaped := false
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth <= 0 {
+				return i + 1
+			}
+		case c == ' ' && depth == 0:
+			return i
+		}
+	}
+	if depth == 0 && !inString {
+		return len(input)
+	}
+	return 0
+}
+
+// CommandParserComponent reads a JSON chat component, producing its JSON
+// text, to be sent with Player.SendRawMessage.
+type CommandParserComponent struct{}
+
+func (c *CommandParserComponent) GetId() string {
+	return "minecraft:component"
+}
+func (c *CommandParserComponent) Parse(reader *StringReader) (interface{}, error) {
+	start := reader.GetCursor()
+	length := scanJSON(reader.GetRemaining())
+	text := reader.GetRemaining()[:length]
+	var decoded interface{}
+	if length == 0 {
+		return nil, reader.Errorf("Invalid chat component: unterminated JSON")
+	}
+	if err := json.Unmarshal([]byte(text), &decoded); err != nil {
+		return nil, reader.errorAt(start, "Invalid chat component: %s", err.Error())
+	}
+	reader.SetCursor(start + length)
+	return text, nil
+}
+func (c *CommandParserComponent) Complete(arg string) []string {
+	return []string{arg}
+}
+func (c *CommandParserComponent) GetSuggestion() CommandSuggestionType {
+	return CommandSuggestionNone
+}
+func (c *CommandParserComponent) writeProperties(player *Player) (err error) {
+	return
+}
@@ -0,0 +1,274 @@
+package typhoon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CommandSyntaxError is a command parse failure at a character offset of
+// the input.
+type CommandSyntaxError struct {
+	Message string
+	Input   string
+	Cursor  int
+}
+
+func (err *CommandSyntaxError) Error() string {
+	if err.Cursor < 0 {
+		return err.Message
+	}
+	return err.Message + " at position " + strconv.Itoa(err.Cursor) + ": " + err.context() + "<--[HERE]"
+}
+
+// context returns up to 10 characters of the input before the cursor.
+func (err *CommandSyntaxError) context() string {
+	cursor := err.Cursor
+	if cursor > len(err.Input) {
+		cursor = len(err.Input)
+	}
+	if cursor > 10 {
+		return "..." + err.Input[cursor-10:cursor]
+	}
+	return err.Input[:cursor]
+}
+
+// Component returns the error the way vanilla displays it: the message,
+// then the input before the cursor, the erroneous part underlined and a
+// "<--[HERE]" marker.
+func (err *CommandSyntaxError) Component() IChatComponent {
+	m := ChatMessage(err.Message)
+	m.SetColor(&ChatColorRed)
+	if err.Cursor < 0 {
+		return m
+	}
+	context := ChatMessage("\n" + err.context())
+	context.SetColor(&ChatColorGray)
+	m.AddExtra(context)
+	if err.Cursor < len(err.Input) {
+		rest := ChatMessage(err.Input[err.Cursor:])
+		rest.SetColor(&ChatColorRed)
+		rest.SetUnderlined(true)
+		m.AddExtra(rest)
+	}
+	here := ChatMessage("<--[HERE]")
+	here.SetColor(&ChatColorRed)
+	here.SetItalic(true)
+	m.AddExtra(here)
+	return m
+}
+
+// StringReader reads a command input from a cursor, the way Brigadier
+// does. Parsers consume their argument from it.
+type StringReader struct {
+	input  string
+	cursor int
+}
+
+func NewStringReader(input string) *StringReader {
+	return &StringReader{
+		input:  input,
+		cursor: 0,
+	}
+}
+
+func (reader *StringReader) GetString() string {
+	return reader.input
+}
+
+func (reader *StringReader) GetCursor() int {
+	return reader.cursor
+}
+
+func (reader *StringReader) SetCursor(cursor int) {
+	reader.cursor = cursor
+}
+
+// GetRead returns the part of the input before the cursor.
+func (reader *StringReader) GetRead() string {
+	return reader.input[:reader.cursor]
+}
+
+// GetRemaining returns the part of the input from the cursor.
+func (reader *StringReader) GetRemaining() string {
+	return reader.input[reader.cursor:]
+}
+
+func (reader *StringReader) CanRead() bool {
+	return reader.cursor < len(reader.input)
+}
+
+func (reader *StringReader) Peek() byte {
+	return reader.input[reader.cursor]
+}
+
+func (reader *StringReader) Read() byte {
+	c := reader.input[reader.cursor]
+	reader.cursor++
+	return c
+}
+
+func (reader *StringReader) Skip() {
+	reader.cursor++
+}
+
+func (reader *StringReader) SkipWhitespace() {
+	for reader.CanRead() && reader.Peek() == ' ' {
+		reader.cursor++
+	}
+}
+
+// Errorf returns a syntax error at the cursor.
+func (reader *StringReader) Errorf(format string, args ...interface{}) *CommandSyntaxError {
+	return reader.errorAt(reader.cursor, format, args...)
+}
+
+func (reader *StringReader) errorAt(cursor int, format string, args ...interface{}) *CommandSyntaxError {
+	return &CommandSyntaxError{
+		Message: fmt.Sprintf(format, args...),
+		Input:   reader.input,
+		Cursor:  cursor,
+	}
+}
+
+// Expect reads the given character or fails.
+func (reader *StringReader) Expect(c byte) error {
+	if !reader.CanRead() || reader.Peek() != c {
+		return reader.Errorf("Expected '%c'", c)
+	}
+	reader.cursor++
+	return nil
+}
+
+func isAllowedNumber(c byte) bool {
+	return c >= '0' && c <= '9' || c == '.' || c == '-'
+}
+
+func isAllowedInUnquotedString(c byte) bool {
+	return c >= '0' && c <= '9' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= 'a' && c <= 'z' ||
+		c == '_' || c == '-' || c == '.' || c == '+'
+}
+
+func (reader *StringReader) readNumber() string {
+	start := reader.cursor
+	for reader.CanRead() && isAllowedNumber(reader.Peek()) {
+		reader.cursor++
+	}
+	return reader.input[start:reader.cursor]
+}
+
+func (reader *StringReader) ReadInt() (int32, error) {
+	start := reader.cursor
+	number := reader.readNumber()
+	if number == "" {
+		return 0, reader.Errorf("Expected integer")
+	}
+	value, err := strconv.ParseInt(number, 10, 32)
+	if err != nil {
+		reader.cursor = start
+		return 0, reader.Errorf("Invalid integer '%s'", number)
+	}
+	return int32(value), nil
+}
+
+func (reader *StringReader) ReadDouble() (float64, error) {
+	start := reader.cursor
+	number := reader.readNumber()
+	if number == "" {
+		return 0, reader.Errorf("Expected double")
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		reader.cursor = start
+		return 0, reader.Errorf("Invalid double '%s'", number)
+	}
+	return value, nil
+}
+
+func (reader *StringReader) ReadFloat() (float32, error) {
+	start := reader.cursor
+	number := reader.readNumber()
+	if number == "" {
+		return 0, reader.Errorf("Expected float")
+	}
+	value, err := strconv.ParseFloat(number, 32)
+	if err != nil {
+		reader.cursor = start
+		return 0, reader.Errorf("Invalid float '%s'", number)
+	}
+	return float32(value), nil
+}
+
+// ReadUnquotedString reads characters allowed in an unquoted string:
+// letters, digits and "_-.+".
+func (reader *StringReader) ReadUnquotedString() string {
+	start := reader.cursor
+	for reader.CanRead() && isAllowedInUnquotedString(reader.Peek()) {
+		reader.cursor++
+	}
+	return reader.input[start:reader.cursor]
+}
+
+// ReadQuotedString reads a string between double or single quotes, in
+// which the quote and the backslash are escaped with a backslash.
+func (reader *StringReader) ReadQuotedString() (string, error) {
+	if !reader.CanRead() {
+		return "", nil
+	}
+	quote := reader.Peek()
+	if quote != '"' && quote != '\'' {
+		return "", reader.Errorf("Expected quote to start a string")
+	}
+	reader.cursor++
+	var result strings.Builder
+	escaped := false
+	for reader.CanRead() {
+		c := reader.Read()
+		if escaped {
+			if c != quote && c != '\\' {
+				reader.cursor--
+				return "", reader.Errorf("Invalid escape sequence '\\%c' in quoted string", c)
+			}
+			result.WriteByte(c)
+			escaped = false
+		} else if c == '\\' {
+			escaped = true
+		} else if c == quote {
+			return result.String(), nil
+		} else {
+			result.WriteByte(c)
+		}
+	}
+	return "", reader.Errorf("Unclosed quoted string")
+}
+
+// ReadString reads a quoted string, or an unquoted one.
+func (reader *StringReader) ReadString() (string, error) {
+	if !reader.CanRead() {
+		return "", nil
+	}
+	if c := reader.Peek(); c == '"' || c == '\'' {
+		return reader.ReadQuotedString()
+	}
+	return reader.ReadUnquotedString(), nil
+}
+
+func (reader *StringReader) ReadBoolean() (bool, error) {
+	start := reader.cursor
+	value, err := reader.ReadString()
+	if err != nil {
+		return false, err
+	}
+	switch value {
+	case "":
+		return false, reader.Errorf("Expected bool")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	reader.cursor = start
+	return false, reader.Errorf("Invalid bool, expected true or false but found '%s'", value)
+}
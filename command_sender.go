@@ -0,0 +1,42 @@
+package typhoon
+
+import (
+	"fmt"
+	"io"
+)
+
+// CommandSender is anything able to run a command: a player, the server
+// console or a remote administration channel such as RCON.
+type CommandSender interface {
+	GetName() string
+	SendMessage(message IChatComponent)
+	HasPermission(permission string) bool
+}
+
+// ConsoleSender runs commands on behalf of the server operator and prints
+// their output as plain text.
+type ConsoleSender struct {
+	wtr io.Writer
+}
+
+func newConsoleSender(wtr io.Writer) *ConsoleSender {
+	return &ConsoleSender{
+		wtr: wtr,
+	}
+}
+
+func (c *Core) GetConsoleSender() *ConsoleSender {
+	return c.console
+}
+
+func (sender *ConsoleSender) GetName() string {
+	return "CONSOLE"
+}
+
+func (sender *ConsoleSender) SendMessage(message IChatComponent) {
+	fmt.Fprintln(sender.wtr, ChatPlainText(message))
+}
+
+func (sender *ConsoleSender) HasPermission(permission string) bool {
+	return true
+}
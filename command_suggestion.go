@@ -0,0 +1,182 @@
+package typhoon
+
+import (
+	"sort"
+	"strings"
+)
+
+// CommandSuggestion is a completion of the argument being typed, with an
+// optional tooltip shown by 1.13+ clients.
+type CommandSuggestion struct {
+	Text    string
+	Tooltip IChatComponent
+}
+
+// SuggestionProvider returns the suggestions for the partial argument
+// typed by the sender. Only the suggestions starting with it are kept.
+// Providers run on a goroutine of their own, not on the network
+// goroutine of the player.
+type SuggestionProvider func(core *Core, sender CommandSender, arg string) []CommandSuggestion
+
+// SuggestingParser is implemented by parsers suggesting values depending
+// on the server state, such as the online players.
+type SuggestingParser interface {
+	Suggest(core *Core, sender CommandSender, arg string) []CommandSuggestion
+}
+
+// SuggestPlayers suggests the names of the online players.
+func SuggestPlayers(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+	players := core.playerRegistry.GetPlayersByPrefix(arg)
+	suggestions := make([]CommandSuggestion, len(players))
+	for i, player := range players {
+		suggestions[i] = CommandSuggestion{Text: player.name}
+	}
+	return suggestions
+}
+
+// SuggestStrings returns a provider suggesting fixed values.
+func SuggestStrings(values ...string) SuggestionProvider {
+	return func(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+		suggestions := make([]CommandSuggestion, len(values))
+		for i, value := range values {
+			suggestions[i] = CommandSuggestion{Text: value}
+		}
+		return suggestions
+	}
+}
+
+// Suggest sets the suggestions of an argument node. 1.13+ clients ask the
+// server for them.
+func (node *CommandNode) Suggest(provider SuggestionProvider) *CommandNode {
+	node.Suggestions = provider
+	return node
+}
+
+// getSuggestion returns the suggestion type advertised for the node.
+func (node *CommandNode) getSuggestion() CommandSuggestionType {
+	if node.Type != CommandNodeTypeArgument {
+		return CommandSuggestionNone
+	}
+	if node.Suggestions != nil {
+		return CommandSuggestionAskServer
+	}
+	if _, ok := node.Parser.(SuggestingParser); ok {
+		return CommandSuggestionAskServer
+	}
+	return node.Parser.GetSuggestion()
+}
+
+// commandCompletion is a node which can complete the input from start.
+type commandCompletion struct {
+	node  *CommandNode
+	start int
+}
+
+func (completion *commandCompletion) suggest(core *Core, sender CommandSender, input string) []CommandSuggestion {
+	node := completion.node
+	arg := input[completion.start:]
+	if node.Type == CommandNodeTypeLiteral {
+		if strings.HasPrefix(node.Name, arg) {
+			return []CommandSuggestion{{Text: node.Name}}
+		}
+		return nil
+	}
+
+	var suggestions []CommandSuggestion
+	if node.Suggestions != nil {
+		suggestions = node.Suggestions(core, sender, arg)
+	} else if parser, ok := node.Parser.(SuggestingParser); ok {
+		suggestions = parser.Suggest(core, sender, arg)
+	} else {
+		for _, text := range node.Parser.Complete(arg) {
+			suggestions = append(suggestions, CommandSuggestion{Text: text})
+		}
+		return suggestions
+	}
+	filtered := suggestions[:0]
+	for _, suggestion := range suggestions {
+		if len(suggestion.Text) >= len(arg) && strings.EqualFold(suggestion.Text[:len(arg)], arg) {
+			filtered = append(filtered, suggestion)
+		}
+	}
+	return filtered
+}
+
+// completeCommand returns the suggestions for the end of the input, and
+// the offset of the text they replace.
+func (c *Core) completeCommand(sender CommandSender, input string) (int, []CommandSuggestion) {
+	c.commandMutex.RLock()
+	completions := c.analyseTabCommand(sender, NewStringReader(input), &c.rootCommand, nil)
+	c.commandMutex.RUnlock()
+
+	start := len(input)
+	for _, completion := range completions {
+		if completion.start < start {
+			start = completion.start
+		}
+	}
+	suggestions := make([]CommandSuggestion, 0)
+	seen := make(map[string]bool)
+	for _, completion := range completions {
+		prefix := input[start:completion.start]
+		for _, suggestion := range completion.suggest(c, sender, input) {
+			suggestion.Text = prefix + suggestion.Text
+			if !seen[suggestion.Text] {
+				seen[suggestion.Text] = true
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	return start, suggestions
+}
+
+// analyseTabCommand returns the nodes which can complete the input.
+func (c *Core) analyseTabCommand(sender CommandSender, reader *StringReader, node *CommandNode, completions []commandCompletion) []commandCompletion {
+	reader.SkipWhitespace()
+	start := reader.GetCursor()
+	for _, child := range node.redirected().Children {
+		if !child.canUse(sender) {
+			continue
+		}
+		reader.SetCursor(start)
+		_, err := child.parse(reader)
+		ended := err != nil || !reader.CanRead()
+		if !ended && reader.Peek() == ' ' {
+			completions = c.analyseTabCommand(sender, reader, child, completions)
+		} else if ended && (child.Type == CommandNodeTypeArgument || !strings.Contains(reader.GetString()[start:], " ")) {
+			completions = append(completions, commandCompletion{child, start})
+		}
+	}
+	return completions
+}
+
+// onTabCommand answers a tab completion request off the network goroutine.
+// The input includes the leading slash.
+func (c *Core) onTabCommand(player *Player, transactionId int, input string) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				player.Log(LevelError, "Tab completion panicked", LogFields{"error": r})
+			}
+		}()
+		offset := 0
+		if strings.HasPrefix(input, "/") {
+			offset = 1
+		}
+		start, suggestions := c.completeCommand(player, input[offset:])
+		if player.protocol < V1_13 && start == 0 && offset == 1 {
+			for i := range suggestions {
+				suggestions[i].Text = "/" + suggestions[i].Text
+			}
+		}
+		player.WritePacket(&PacketPlayTabComplete{
+			TransactionId: transactionId,
+			Start:         start + offset,
+			Length:        len(input) - start - offset,
+			Suggestions:   suggestions,
+		})
+	}()
+}
@@ -0,0 +1,566 @@
+package typhoon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatchCommandConsole(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	c.DeclareCommand(CommandNodeLiteral("whoami", nil, func(ctx *CommandContext) {
+		ctx.GetSender().SendMessage(ChatMessage(ctx.GetSender().GetName()))
+	}))
+
+	out := &bytes.Buffer{}
+	console := newConsoleSender(out)
+	c.DispatchCommand(console, "/whoami")
+	c.DispatchCommand(console, "missing")
+
+	if out.String() != "CONSOLE\n"+commandUnknownCommand+"\nmissing<--[HERE]\n" {
+		t.Logf("Console received %q", out.String())
+		t.Fail()
+	}
+}
+
+func TestStringReaderQuotedString(t *testing.T) {
+	reader := NewStringReader(`"say \"hi\" \\ there" 'it''s'`)
+	value, err := reader.ReadString()
+	if err != nil || value != `say "hi" \ there` {
+		t.Log("Invalid quoted string", value, err)
+		t.Fail()
+	}
+	reader.SkipWhitespace()
+	if value, err := reader.ReadString(); err != nil || value != "it" || reader.GetRemaining() != "'s'" {
+		t.Log("Invalid single quoted string", value, err)
+		t.Fail()
+	}
+
+	reader = NewStringReader(`"bad \n escape"`)
+	if _, err := reader.ReadQuotedString(); err == nil || err.(*CommandSyntaxError).Cursor != 6 {
+		t.Log("Invalid escape error", err)
+		t.Fail()
+	}
+	reader = NewStringReader(`"unclosed`)
+	if _, err := reader.ReadQuotedString(); err == nil || err.(*CommandSyntaxError).Message != "Unclosed quoted string" {
+		t.Log("Invalid unclosed string error", err)
+		t.Fail()
+	}
+}
+
+func TestDispatchCommandArguments(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	var received []string
+	amount := 0
+	execute := func(ctx *CommandContext) {
+		received = ctx.GetArgs()
+		amount = ctx.GetInt("amount")
+	}
+	c.DeclareCommand(CommandNodeLiteral("give", []*CommandNode{
+		CommandNodeArgument("item", []*CommandNode{
+			CommandNodeArgument("amount", nil, &CommandParserInteger{Min: OptInteger{true, 1}, Max: OptInteger{true, 64}}, execute),
+		}, &CommandParserString{Format: CommandParserStringFormatQuotablePhrase}, execute),
+	}, nil))
+
+	out := &bytes.Buffer{}
+	console := newConsoleSender(out)
+	c.DispatchCommand(console, `give  "diamond sword"   12`)
+	if len(received) != 3 || received[1] != "diamond sword" || received[2] != "12" || amount != 12 {
+		t.Log("Invalid arguments", received)
+		t.Fail()
+	}
+
+	c.DispatchCommand(console, `give "diamond sword" 128`)
+	c.DispatchCommand(console, `give stone 1x`)
+	c.DispatchCommand(console, `give`)
+	expected := "Integer must not be more than 64, found 128\n...nd sword\" 128<--[HERE]\n" +
+		"Expected whitespace to end one argument, but found trailing data\n...ve stone 1x<--[HERE]\n" +
+		commandUnknownCommand + "\ngive<--[HERE]\n"
+	if out.String() != expected {
+		t.Logf("Console received %q", out.String())
+		t.Fail()
+	}
+}
+
+func TestMinecraftParsers(t *testing.T) {
+	parse := func(parser CommandParser, input string) (interface{}, error) {
+		reader := NewStringReader(input)
+		value, err := parser.Parse(reader)
+		if err == nil && reader.CanRead() {
+			t.Log("Input not consumed:", input, reader.GetRemaining())
+			t.Fail()
+		}
+		return value, err
+	}
+
+	value, err := parse(&CommandParserEntity{}, "@a[limit=2,name=!Steve]")
+	if selector, ok := value.(*EntitySelector); err != nil || !ok || selector.Kind != 'a' || selector.Limit != 2 || selector.NameFilter != "Steve" || !selector.NameExcluded {
+		t.Log("Invalid selector", value, err)
+		t.Fail()
+	}
+	if _, err := parse(&CommandParserEntity{Single: true, PlayersOnly: true}, "@a"); err == nil {
+		t.Log("Single player parser accepted @a")
+		t.Fail()
+	}
+	if _, err := parse(&CommandParserEntity{PlayersOnly: true}, "@e"); err == nil {
+		t.Log("Players only parser accepted @e")
+		t.Fail()
+	}
+	if _, err := parse(&CommandParserEntity{}, "@a[foo=1]"); err == nil || err.(*CommandSyntaxError).Cursor != 3 {
+		t.Log("Invalid unknown option error", err)
+		t.Fail()
+	}
+
+	value, err = parse(&CommandParserBlockPos{}, "~ ~-1 10")
+	if coordinates, ok := value.(*CommandCoordinates); err != nil || !ok || coordinates.ResolveBlock(5.5, 64, 0, 0, 0) != (Position{5, 63, 10}) {
+		t.Log("Invalid block position", value, err)
+		t.Fail()
+	}
+	if _, err := parse(&CommandParserBlockPos{}, "~ ^ 1"); err == nil {
+		t.Log("Mixed world and local coordinates accepted")
+		t.Fail()
+	}
+	value, err = parse(&CommandParserVec3{}, "1 2 3.25")
+	if x, y, z := value.(*CommandCoordinates).Resolve(0, 0, 0, 0, 0); err != nil || x != 1.5 || y != 2 || z != 3.25 {
+		t.Log("Invalid vec3", x, y, z, err)
+		t.Fail()
+	}
+	value, err = parse(&CommandParserVec3{}, "^ ^ ^2")
+	if x, _, z := value.(*CommandCoordinates).Resolve(0, 0, 0, 0, 0); err != nil || math.Abs(x) > 1e-9 || math.Abs(z-2) > 1e-9 {
+		t.Log("Invalid local coordinates", x, z, err)
+		t.Fail()
+	}
+
+	if value, err := parse(&CommandParserColor{}, "dark_red"); err != nil || value.(*ChatColor).GetName() != "dark_red" {
+		t.Log("Invalid color", value, err)
+		t.Fail()
+	}
+	if value, err := parse(&CommandParserComponent{}, `{"text":"a } b"}`); err != nil || value != `{"text":"a } b"}` {
+		t.Log("Invalid component", value, err)
+		t.Fail()
+	}
+	if _, err := parse(&CommandParserComponent{}, `{"text":`); err == nil {
+		t.Log("Unterminated component accepted")
+		t.Fail()
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	tooltip := ChatMessage("The Nether")
+	c.DeclareCommand(CommandNodeLiteral("world", []*CommandNode{
+		CommandNodeArgument("name", nil, &CommandParserString{Format: CommandParserStringFormatQuotablePhrase}, nil).
+			Suggest(func(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+				return []CommandSuggestion{{Text: "overworld"}, {Text: "nether", Tooltip: tooltip}, {Text: "end"}}
+			}),
+	}, nil))
+	c.DeclareCommand(CommandNodeLiteral("whitelist", nil, nil))
+	console := newConsoleSender(&bytes.Buffer{})
+
+	start, suggestions := c.completeCommand(console, "w")
+	if start != 0 || len(suggestions) != 2 || suggestions[0].Text != "whitelist" || suggestions[1].Text != "world" {
+		t.Log("Invalid literal suggestions", start, suggestions)
+		t.Fail()
+	}
+	start, suggestions = c.completeCommand(console, "world  NE")
+	if start != 7 || len(suggestions) != 1 || suggestions[0].Text != "nether" || suggestions[0].Tooltip != tooltip {
+		t.Log("Invalid argument suggestions", start, suggestions)
+		t.Fail()
+	}
+	if start, suggestions = c.completeCommand(console, "world nether "); len(suggestions) != 0 {
+		t.Log("Suggestions after a complete command", start, suggestions)
+		t.Fail()
+	}
+
+	commands := c.compileCommands(console)
+	if commands[2].Suggestion != CommandSuggestionAskServer || commands[1].Suggestion != CommandSuggestionNone {
+		t.Log("Suggestion provider not advertised", commands)
+		t.Fail()
+	}
+}
+
+func TestCompileSharedChild(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	target := CommandNodeArgument("target", nil, &CommandParserString{Format: CommandParserStringFormatSingleWord}, func(ctx *CommandContext) {})
+	c.DeclareCommand(CommandNodeLiteral("kick", []*CommandNode{target}, nil))
+	c.DeclareCommand(CommandNodeLiteral("kill", []*CommandNode{target}, nil))
+
+	commands := c.compileCommands(c.console)
+	if len(commands) != 4 {
+		t.Log("Shared child indexed more than once", commands)
+		t.Fail()
+		return
+	}
+	for i, command := range commands {
+		if command.Name == "" && i != 0 {
+			t.Log("Node left empty", i, commands)
+			t.Fail()
+		}
+		for _, child := range command.Children {
+			if child < 0 || child >= len(commands) {
+				t.Log("Child out of the graph", i, commands)
+				t.Fail()
+			}
+		}
+	}
+	if commands[1].Children[0] != commands[3].Children[0] {
+		t.Log("Shared child compiled twice", commands)
+		t.Fail()
+	}
+}
+
+func TestCommandRedirect(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	var target string
+	var x int
+	teleport := CommandNodeLiteral("teleport", []*CommandNode{
+		CommandNodeArgument("target", []*CommandNode{
+			CommandNodeArgument("x", nil, &CommandParserInteger{}, func(ctx *CommandContext) {
+				target, x = ctx.GetString("target"), ctx.GetInt("x")
+			}),
+		}, &CommandParserString{Format: CommandParserStringFormatSingleWord}, nil),
+	}, nil)
+	c.DeclareCommand(teleport)
+	c.DeclareAlias("tp", teleport)
+	sender := &testSender{permissions: PermissionSet{}}
+
+	c.DispatchCommand(sender, "tp Steve 3")
+	if target != "Steve" || x != 3 || len(sender.messages) != 0 {
+		t.Log("Alias not redirected", target, x, sender.messages)
+		t.Fail()
+	}
+
+	other := &testSender{permissions: PermissionSet{}}
+	var senders []CommandSender
+	c.DeclareCommand(CommandNodeLiteral("twice", nil, nil).Fork(&c.rootCommand, func(ctx *CommandContext) []CommandSender {
+		return []CommandSender{ctx.GetSender(), other}
+	}))
+	c.DeclareCommand(CommandNodeLiteral("say", nil, func(ctx *CommandContext) {
+		senders = append(senders, ctx.GetSender())
+	}))
+	c.DispatchCommand(sender, "twice twice say")
+	if len(senders) != 4 || senders[0] != sender || senders[3] != other {
+		t.Log("Command not forked", senders)
+		t.Fail()
+	}
+	if start, suggestions := c.completeCommand(sender, "twice s"); start != 6 || len(suggestions) != 1 || suggestions[0].Text != "say" {
+		t.Log("Redirection not completed", start, suggestions)
+		t.Fail()
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	c.DeclareCommand(c.HelpCommand())
+	ban := c.BanCommand()
+	c.DeclareCommand(ban)
+	c.DeclareAlias("b", ban)
+	c.DeclareCommand(c.WhitelistCommand())
+	c.DeclareCommand(CommandNodeLiteral("run", nil, nil).Redirect(&c.rootCommand))
+
+	for _, test := range []struct {
+		command  string
+		expected []string
+	}{
+		{"help", []string{
+			"/b -> ban",
+			"/ban <target> [<reason>]",
+			"/help [<command>]",
+			"/run ...",
+			"/whitelist (add|remove|list|on|off)",
+		}},
+		{"help whitelist", []string{
+			"/whitelist add <target>",
+			"/whitelist remove <target>",
+			"/whitelist list",
+			"/whitelist on",
+			"/whitelist off",
+		}},
+		{"help ban Steve", []string{"/ban Steve [<reason>]"}},
+		{"help stop", []string{"Unknown command or insufficient permissions"}},
+	} {
+		sender := &testSender{permissions: PermissionSet{"*": true}}
+		c.DispatchCommand(sender, test.command)
+		if len(sender.messages) != len(test.expected) {
+			t.Log("Invalid help for", test.command, sender.messages)
+			t.Fail()
+			continue
+		}
+		for i, message := range sender.messages {
+			if message != test.expected[i] {
+				t.Log("Invalid help for", test.command, sender.messages)
+				t.Fail()
+				break
+			}
+		}
+	}
+
+	sender := &testSender{permissions: PermissionSet{}}
+	c.DispatchCommand(sender, "help")
+	if len(sender.messages) != 2 || sender.messages[0] != "/help [<command>]" || sender.messages[1] != "/run ..." {
+		t.Log("Help lists commands without permission", sender.messages)
+		t.Fail()
+	}
+}
+
+func TestCommandHooks(t *testing.T) {
+	config := DefaultConfig()
+	config.Commands.Cooldown = 60000
+	c := newCore(config, "")
+	runs := 0
+	say := CommandNodeLiteral("say", nil, func(ctx *CommandContext) {
+		runs++
+	}).WithCooldown(time.Hour, "Wait {remaining}")
+	c.DeclareCommand(say)
+	c.DeclareAlias("s", say)
+	c.On(func(e *PreCommandEvent) {
+		if e.Command == "hello" {
+			e.Command = "say"
+		}
+		e.Cancelled = e.Command == "cancelled"
+	})
+	var posts []PostCommandEvent
+	c.On(func(e *PostCommandEvent) {
+		posts = append(posts, *e)
+	})
+
+	admin := &testSender{permissions: PermissionSet{CooldownBypassPermission: true}}
+	c.DispatchCommand(admin, "hello")
+	c.DispatchCommand(admin, "s")
+	c.DispatchCommand(admin, "cancelled")
+	if runs != 2 || len(posts) != 2 || !posts[0].Success || posts[0].Command != "say" || posts[1].Sender != admin {
+		t.Log("Invalid command events", runs, posts)
+		t.Fail()
+	}
+
+	user := &testSender{permissions: PermissionSet{}}
+	c.DispatchCommand(user, "say")
+	c.DispatchCommand(user, "say")
+	if runs != 3 || posts[3].Success || len(user.messages) != 1 || user.messages[0] != "You must wait 60s before running this command again" {
+		t.Log("Sender cooldown not applied", runs, user.messages)
+		t.Fail()
+	}
+	c.cooldowns.until[cooldownKey{user.GetName(), nil}] = time.Time{}
+	c.DispatchCommand(user, "s")
+	if runs != 3 || len(user.messages) != 2 || user.messages[1] != "Wait 3600s" {
+		t.Log("Command cooldown not shared by its alias", runs, user.messages)
+		t.Fail()
+	}
+
+	c.cooldowns.until = make(map[cooldownKey]time.Time)
+	c.DispatchCommand(user, "sya")
+	c.DispatchCommand(user, "say")
+	if runs != 4 {
+		t.Log("Cooldown taken by an unknown command", runs, user.messages)
+		t.Fail()
+	}
+
+	fails := 0
+	c.DeclareCommand(CommandNodeLiteral("fail", nil, func(ctx *CommandContext) {
+		fails++
+		ctx.Fail("Failed")
+	}).WithCooldown(time.Hour, "Wait {remaining}"))
+	c.cooldowns.until = make(map[cooldownKey]time.Time)
+	posts = nil
+	c.DispatchCommand(user, "fail")
+	c.DispatchCommand(user, "fail")
+	if fails != 2 || len(posts) != 2 || posts[0].Success || posts[1].Success || user.messages[len(user.messages)-1] != "Failed" {
+		t.Log("Cooldown taken by a failed command", fails, posts, user.messages)
+		t.Fail()
+	}
+}
+
+type testHandler struct {
+	calls []string
+}
+
+type testTeleportArgs struct {
+	X       int32   `command:"x,min=-10,max=10"`
+	Y       float64 `command:"y,optional"`
+	Comment string  `command:",optional,greedy"`
+	ignored bool
+}
+
+func (h *testHandler) Teleport(ctx *CommandContext, args testTeleportArgs) {
+	h.calls = append(h.calls, "teleport "+strconv.Itoa(int(args.X))+" "+strconv.FormatFloat(args.Y, 'f', -1, 64)+" "+args.Comment)
+}
+
+func (h *testHandler) WhitelistOn(ctx *CommandContext) {
+	h.calls = append(h.calls, "on")
+}
+
+func (h *testHandler) Whitelist_Add(ctx *CommandContext, args struct {
+	Target string `command:"target,suggest=players"`
+}) {
+	h.calls = append(h.calls, "add "+args.Target)
+}
+
+func (h *testHandler) String() string {
+	return "not a command"
+}
+
+func TestCommandsFromHandler(t *testing.T) {
+	handler := &testHandler{}
+	commands, err := CommandsFromHandler(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 3 || commands[0].Name != "teleport" || commands[1].Name != "whitelist-on" || commands[2].Name != "whitelist" {
+		t.Log("Invalid commands", commands)
+		t.Fatal()
+	}
+	x := commands[0].Children[0]
+	if parser, ok := x.Parser.(*CommandParserInteger); !ok || parser.Min != (OptInteger{true, -10}) || parser.Max != (OptInteger{true, 10}) || x.Execute == nil {
+		t.Log("Invalid integer argument", x)
+		t.Fail()
+	}
+	if comment := x.Children[0].Children[0]; comment.Name != "comment" || comment.Parser.(*CommandParserString).Format != CommandParserStringFormatGreedyPhrase {
+		t.Log("Invalid string argument", comment)
+		t.Fail()
+	}
+	if commands[2].Execute != nil || commands[2].Children[0].Children[0].Suggestions == nil {
+		t.Log("Invalid whitelist command", commands[2])
+		t.Fail()
+	}
+
+	c := newCore(DefaultConfig(), "")
+	if err := c.DeclareHandler(handler); err != nil {
+		t.Fatal(err)
+	}
+	sender := &testSender{permissions: PermissionSet{}}
+	for _, command := range []string{"teleport 3", "teleport -2 1.5 over there", "teleport 11", "whitelist add Steve", "whitelist-on"} {
+		c.DispatchCommand(sender, command)
+	}
+	expected := []string{"teleport 3 0 ", "teleport -2 1.5 over there", "add Steve", "on"}
+	if len(handler.calls) != len(expected) || len(sender.messages) != 1 {
+		t.Log("Invalid calls", handler.calls, sender.messages)
+		t.Fatal()
+	}
+	for i, call := range handler.calls {
+		if call != expected[i] {
+			t.Log("Invalid calls", handler.calls)
+			t.Fail()
+		}
+	}
+
+	if _, err := CommandsFromHandler(&struct{ testInvalidHandler }{}); err == nil {
+		t.Log("Required argument after an optional one accepted")
+		t.Fail()
+	}
+}
+
+type testInvalidHandler struct{}
+
+func (testInvalidHandler) Give(ctx *CommandContext, args struct {
+	Count  int    `command:"count,optional"`
+	Target string `command:"target"`
+}) {
+}
+
+func TestTabCompleteConcurrentWrites(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	conn, client := net.Pipe()
+	defer conn.Close()
+	player := &Player{core: c, conn: conn, state: int32(PLAY), protocol: V1_15_1, writeMutex: &sync.Mutex{}}
+
+	const count = 50
+	frames := make(chan []byte)
+	go func() {
+		reader := bufio.NewReader(client)
+		for {
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				close(frames)
+				return
+			}
+			frame := make([]byte, length)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				close(frames)
+				return
+			}
+			frames <- frame
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(2)
+		go func() {
+			player.WritePacket(&PacketPlayTabComplete{
+				TransactionId: 1,
+				Start:         1,
+				Length:        2,
+				Suggestions:   []CommandSuggestion{{Text: "help"}, {Text: "hello", Tooltip: ChatMessage("Hello")}},
+			})
+			wg.Done()
+		}()
+		go func() {
+			player.SendMessage(ChatMessage("Hello world"))
+			wg.Done()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		client.Close()
+	}()
+
+	ids := make(map[uint64]int)
+	for frame := range frames {
+		id, _ := binary.Uvarint(frame)
+		ids[id]++
+	}
+	if len(ids) != 2 {
+		t.Log("Packets interleaved", ids)
+		t.Fail()
+	}
+	for id, n := range ids {
+		if n != count {
+			t.Log("Invalid packet count", id, n)
+			t.Fail()
+		}
+	}
+}
+
+func TestTabCompleteWithoutScheduler(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	c.DeclareCommand(CommandNodeLiteral("help", nil, func(ctx *CommandContext) {}))
+	conn, client := net.Pipe()
+	defer conn.Close()
+	defer client.Close()
+	player := &Player{core: c, conn: conn, state: int32(PLAY), protocol: V1_15_1, writeMutex: &sync.Mutex{}}
+
+	c.onTabCommand(player, 1, "/he")
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := binary.ReadUvarint(bufio.NewReader(client)); err != nil {
+		t.Log("Tab completion not answered before the server started", err)
+		t.Fail()
+	}
+}
+
+func TestGameProfileOffline(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	var profiles []GameProfile
+	c.DeclareCommand(CommandNodeLiteral("whois", []*CommandNode{
+		CommandNodeArgument("target", nil, &CommandParserGameProfile{}, func(ctx *CommandContext) {
+			profiles = ctx.GetProfiles("target")
+		}),
+	}, nil))
+
+	c.DispatchCommand(c.console, "whois Notch")
+	if len(profiles) != 1 || profiles[0].Name != "Notch" || profiles[0].UUID != OfflineUUID("Notch") {
+		t.Log("Offline name not resolved to its offline profile", profiles)
+		t.Fail()
+	}
+	c.DispatchCommand(c.console, "whois @a")
+	if len(profiles) != 0 {
+		t.Log("Selector matched offline players", profiles)
+		t.Fail()
+	}
+}
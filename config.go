@@ -3,7 +3,20 @@ package typhoon
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	ConfigPathEnv = "TYPHOON_CONFIG"
+
+	defaultConfigPath  = "./config.json"
+	defaultFaviconPath = "./favicon.png"
 )
 
 type BufferConfig struct {
@@ -12,44 +25,467 @@ type BufferConfig struct {
 	ChatMessage      int `json:"chat_message"`
 }
 
+type RconConfig struct {
+	Enabled       bool   `json:"enabled"`
+	ListenAddress string `json:"listen_address"`
+	Password      string `json:"password"`
+}
+
+type QueryConfig struct {
+	Enabled       bool   `json:"enabled"`
+	ListenAddress string `json:"listen_address"`
+	RateLimit     int    `json:"rate_limit"`
+}
+
+// TraceConfig enables packet traces per direction. When Packets is not
+// empty, only the packet types it names (e.g. "PacketPlayChat") are traced.
+type TraceConfig struct {
+	Inbound  bool     `json:"inbound"`
+	Outbound bool     `json:"outbound"`
+	Packets  []string `json:"packets"`
+}
+
+type LogConfig struct {
+	Level LogLevel    `json:"level"`
+	Trace TraceConfig `json:"trace"`
+}
+
+// ThrottleConfig limits the connections of each IP address and the packets
+// of each player. Timeouts are in seconds and any zero value disables the
+// corresponding limit. The limits per IP address are disabled by default,
+// as every player comes from the same address behind a proxy such as
+// BungeeCord or Velocity.
+type ThrottleConfig struct {
+	ConnectionsPerMinute int `json:"connections_per_minute"`
+	ConnectionBurst      int `json:"connection_burst"`
+	MaxConnectionsPerIp  int `json:"max_connections_per_ip"`
+	HandshakeTimeout     int `json:"handshake_timeout"`
+	LoginTimeout         int `json:"login_timeout"`
+	PacketsPerSecond     int `json:"packets_per_second"`
+}
+
+// AccessConfig sets the paths of the vanilla ban and whitelist files. An
+// empty path, the default, keeps the corresponding list in memory.
+type AccessConfig struct {
+	BannedPlayers    string `json:"banned_players"`
+	BannedIps        string `json:"banned_ips"`
+	Whitelist        string `json:"whitelist"`
+	EnforceWhitelist bool   `json:"enforce_whitelist"`
+}
+
+// KeepAliveConfig sets, in seconds, how often players are sent a keepalive
+// and how long they have to answer it before being kicked.
+type KeepAliveConfig struct {
+	Interval int `json:"interval"`
+	Timeout  int `json:"timeout"`
+}
+
+type CommandsConfig struct {
+	Cooldown        int    `json:"cooldown"`         // milliseconds between two commands of a sender, 0 disables it
+	CooldownMessage string `json:"cooldown_message"` // {remaining} is replaced by the time left
+}
+
+type MetricsConfig struct {
+	Enabled       bool   `json:"enabled"`
+	ListenAddress string `json:"listen_address"`
+	Path          string `json:"path"`
+}
+
 type Config struct {
-	ListenAddress string       `json:"listen_address"`
-	MaxPlayers    int          `json:"max_players"`
-	Motd          string       `json:"motd"`
-	Restricted    bool         `json:"restricted"`
-	Logs          bool         `json:"logs"`
-	Compression   bool         `json:"enable_compression"`
-	Threshold     int          `json:"compression_threshold"`
-	BufferConfig  BufferConfig `json:"buffer_config"`
-}
-
-var (
-	config  Config
-	favicon string
-)
+	ListenAddress   string          `json:"listen_address"`
+	MaxPlayers      int             `json:"max_players"`
+	Motd            string          `json:"motd"`
+	Favicon         string          `json:"favicon"`
+	Restricted      bool            `json:"restricted"`
+	ShutdownMessage string          `json:"shutdown_message"`
+	WatchConfig     bool            `json:"watch_config"`
+	Log             LogConfig       `json:"log"`
+	Logs            bool            `json:"logs"` // Deprecated: traces every packet, use Log.Trace
+	Compression     bool            `json:"enable_compression"`
+	Threshold       int             `json:"compression_threshold"`
+	BufferConfig    BufferConfig    `json:"buffer_config"`
+	KeepAlive       KeepAliveConfig `json:"keepalive"`
+	ReadTimeout     int             `json:"read_timeout"` // seconds before PLAY, 0 disables it
+	Throttle        ThrottleConfig  `json:"throttle"`
+	Access          AccessConfig    `json:"access"`
+	Permissions     string          `json:"permissions"` // permission groups file, empty grants no permission
+	Commands        CommandsConfig  `json:"commands"`
+	Rcon            RconConfig      `json:"rcon"`
+	Query           QueryConfig     `json:"query"`
+	Metrics         MetricsConfig   `json:"metrics"`
+
+	VirtualHosts map[string]VirtualHostConfig `json:"virtual_hosts"`
+}
 
-func initConfig() (err error) {
-	fav, err := ioutil.ReadFile("./favicon.png")
-	if err == nil {
-		favicon = "data:image/png;base64," + base64.StdEncoding.EncodeToString(fav)
+// DefaultConfig returns the configuration used for any value missing from
+// a configuration file.
+func DefaultConfig() Config {
+	return Config{
+		ListenAddress:   ":25565",
+		MaxPlayers:      100,
+		Motd:            "Typhoon server",
+		Favicon:         defaultFaviconPath,
+		Restricted:      false,
+		ShutdownMessage: "Server closed",
+		WatchConfig:     false,
+		Log: LogConfig{
+			Level: LevelInfo,
+			Trace: TraceConfig{
+				Inbound:  false,
+				Outbound: false,
+				Packets:  nil,
+			},
+		},
+		Logs:        false,
+		Compression: false,
+		Threshold:   256,
+		BufferConfig: BufferConfig{
+			HandshakeAddress: 300,
+			PlayerName:       16,
+			ChatMessage:      32767,
+		},
+		KeepAlive: KeepAliveConfig{
+			Interval: 5,
+			Timeout:  30,
+		},
+		ReadTimeout: 10,
+		Throttle: ThrottleConfig{
+			ConnectionsPerMinute: 0,
+			ConnectionBurst:      10,
+			MaxConnectionsPerIp:  0,
+			HandshakeTimeout:     5,
+			LoginTimeout:         30,
+			PacketsPerSecond:     500,
+		},
+		Access: AccessConfig{
+			BannedPlayers:    "",
+			BannedIps:        "",
+			Whitelist:        "",
+			EnforceWhitelist: false,
+		},
+		Permissions: "",
+		Commands: CommandsConfig{
+			Cooldown:        0,
+			CooldownMessage: "You must wait {remaining} before running this command again",
+		},
+		Rcon: RconConfig{
+			Enabled:       false,
+			ListenAddress: ":25575",
+			Password:      "",
+		},
+		Query: QueryConfig{
+			Enabled:       false,
+			ListenAddress: ":25565",
+			RateLimit:     5,
+		},
+		Metrics: MetricsConfig{
+			Enabled:       false,
+			ListenAddress: "127.0.0.1:9225",
+			Path:          "/metrics",
+		},
 	}
+}
+
+// ConfigPath returns the configuration file path set in the TYPHOON_CONFIG
+// environment variable, or ./config.json.
+func ConfigPath() string {
+	if path := os.Getenv(ConfigPathEnv); path != "" {
+		return path
+	}
+	return defaultConfigPath
+}
 
-	file, err := ioutil.ReadFile("./config.json")
+// LoadConfig reads a JSON configuration file on top of DefaultConfig and
+// validates it.
+func LoadConfig(path string) (Config, error) {
+	config, _, err := loadConfigFile(path)
+	return config, err
+}
+
+func loadConfigFile(path string) (config Config, raw []byte, err error) {
+	config = DefaultConfig()
+	raw, err = ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return
 	}
-	if err := json.Unmarshal(file, &config); err != nil {
-		panic(err)
+	if err = json.Unmarshal(raw, &config); err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+		return
+	}
+	if err = config.Validate(); err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
 	}
 	return
 }
 
-func (c *Core) GetConfig(config interface{}) {
-	file, err := ioutil.ReadFile("./config.json")
+func (config *Config) Validate() error {
+	if err := validateListenAddress("listen_address", config.ListenAddress); err != nil {
+		return err
+	}
+	if config.MaxPlayers < 0 {
+		return errors.New("max_players must not be negative")
+	}
+	if config.Threshold < 0 {
+		return errors.New("compression_threshold must not be negative")
+	}
+	if config.BufferConfig.HandshakeAddress <= 0 {
+		return errors.New("buffer_config.handshake_address must be positive")
+	}
+	if config.BufferConfig.PlayerName <= 0 {
+		return errors.New("buffer_config.player_name must be positive")
+	}
+	if config.BufferConfig.ChatMessage <= 0 {
+		return errors.New("buffer_config.chat_message must be positive")
+	}
+	if config.KeepAlive.Interval <= 0 {
+		return errors.New("keepalive.interval must be positive")
+	}
+	if config.KeepAlive.Timeout <= 0 {
+		return errors.New("keepalive.timeout must be positive")
+	}
+	if config.ReadTimeout < 0 {
+		return errors.New("read_timeout must not be negative")
+	}
+	throttle := config.Throttle
+	if throttle.ConnectionsPerMinute < 0 || throttle.MaxConnectionsPerIp < 0 ||
+		throttle.HandshakeTimeout < 0 || throttle.LoginTimeout < 0 || throttle.PacketsPerSecond < 0 {
+		return errors.New("throttle values must not be negative")
+	}
+	if throttle.ConnectionsPerMinute > 0 && throttle.ConnectionBurst <= 0 {
+		return errors.New("throttle.connection_burst must be positive when connections_per_minute is set")
+	}
+	if config.Commands.Cooldown < 0 {
+		return errors.New("commands.cooldown must not be negative")
+	}
+	if config.Rcon.Enabled {
+		if err := validateListenAddress("rcon.listen_address", config.Rcon.ListenAddress); err != nil {
+			return err
+		}
+		if config.Rcon.Password == "" {
+			return errors.New("rcon.password must be set when rcon is enabled")
+		}
+	}
+	if config.Query.Enabled {
+		if err := validateListenAddress("query.listen_address", config.Query.ListenAddress); err != nil {
+			return err
+		}
+	}
+	if config.Query.RateLimit < 0 {
+		return errors.New("query.rate_limit must not be negative")
+	}
+	if config.Metrics.Enabled {
+		if err := validateListenAddress("metrics.listen_address", config.Metrics.ListenAddress); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(config.Metrics.Path, "/") {
+			return errors.New("metrics.path must start with /")
+		}
+	}
+	return validateVirtualHosts(config.VirtualHosts)
+}
+
+func validateListenAddress(key string, address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", key, address, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid %s %q: port must be a number between 0 and 65535", key, address)
+	}
+	return nil
+}
+
+func loadFavicon(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	fav, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && path == defaultFaviconPath {
+			return "", nil
+		}
+		return "", err
+	}
+	return encodeFavicon(fav), nil
+}
+
+func encodeFavicon(data []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// GetConfig decodes the configuration the core was created with into
+// config, which lets plugins read their own keys from the same file.
+func (c *Core) GetConfig(config interface{}) error {
+	return json.Unmarshal(c.config.Load().(*loadedConfig).raw, config)
+}
+
+type loadedConfig struct {
+	config       Config
+	raw          []byte
+	favicon      string
+	hostFavicons map[string]string
+}
+
+func (c *Core) getConfig() *Config {
+	return &c.config.Load().(*loadedConfig).config
+}
+
+func (c *Core) getFavicon() string {
+	if c.customFavicon != "" {
+		return c.customFavicon
+	}
+	return c.config.Load().(*loadedConfig).favicon
+}
+
+// ReloadConfig reads the configuration file the core was created from
+// again and applies it to new connections, see SetConfig.
+func (c *Core) ReloadConfig() error {
+	if c.configPath == "" {
+		return errors.New("typhoon: core was not created from a configuration file")
+	}
+	info, err := os.Stat(c.configPath)
+	if err != nil {
+		return err
+	}
+	// Recorded before parsing, so that watchConfig doesn't parse a broken
+	// file again until it changes.
+	c.configMutex.Lock()
+	c.configModTime = info.ModTime()
+	c.configMutex.Unlock()
+	config, raw, err := loadConfigFile(c.configPath)
+	if err != nil {
+		return err
+	}
+	return c.applyConfig(config, raw)
+}
+
+// SetConfig replaces the running configuration and fires a
+// ConfigReloadEvent. Settings which can't change while the server is
+// listening keep their previous value and are listed in the event.
+func (c *Core) SetConfig(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(&config)
+	if err != nil {
+		return err
+	}
+	return c.applyConfig(config, raw)
+}
+
+func (c *Core) applyConfig(config Config, raw []byte) error {
+	favicon, err := loadFavicon(config.Favicon)
+	if err != nil {
+		return err
+	}
+	hostFavicons, err := loadVirtualHostFavicons(config.VirtualHosts)
+	if err != nil {
+		return err
+	}
+
+	c.connMutex.Lock()
+	listening := c.listener != nil
+	c.connMutex.Unlock()
+
+	c.configMutex.Lock()
+	old := *c.getConfig()
+	restartRequired := make([]string, 0)
+	if listening && config.ListenAddress != old.ListenAddress {
+		restartRequired = append(restartRequired, "listen_address")
+		config.ListenAddress = old.ListenAddress
+	}
+	if listening && (config.Rcon.Enabled != old.Rcon.Enabled ||
+		config.Rcon.ListenAddress != old.Rcon.ListenAddress) {
+		restartRequired = append(restartRequired, "rcon")
+		config.Rcon.Enabled = old.Rcon.Enabled
+		config.Rcon.ListenAddress = old.Rcon.ListenAddress
+	}
+	if listening && (config.Query.Enabled != old.Query.Enabled ||
+		config.Query.ListenAddress != old.Query.ListenAddress) {
+		restartRequired = append(restartRequired, "query")
+		config.Query.Enabled = old.Query.Enabled
+		config.Query.ListenAddress = old.Query.ListenAddress
+	}
+	if config.Access.BannedPlayers != old.Access.BannedPlayers ||
+		config.Access.BannedIps != old.Access.BannedIps ||
+		config.Access.Whitelist != old.Access.Whitelist {
+		restartRequired = append(restartRequired, "access")
+		enforceWhitelist := config.Access.EnforceWhitelist
+		config.Access = old.Access
+		config.Access.EnforceWhitelist = enforceWhitelist
+	}
+	if config.Access.EnforceWhitelist != old.Access.EnforceWhitelist {
+		c.whitelist.SetEnabled(config.Access.EnforceWhitelist)
+	}
+	if config.Permissions != old.Permissions {
+		restartRequired = append(restartRequired, "permissions")
+		config.Permissions = old.Permissions
+	}
+	if listening && config.Metrics != old.Metrics {
+		restartRequired = append(restartRequired, "metrics")
+		config.Metrics = old.Metrics
+	}
+	raw, err = revertRawConfig(raw, &config, restartRequired)
+	if err != nil {
+		c.configMutex.Unlock()
+		return err
+	}
+	c.config.Store(&loadedConfig{config, raw, favicon, hostFavicons})
+	c.configMutex.Unlock()
+
+	for _, key := range restartRequired {
+		c.Log(LevelWarn, "Config value changed, restart the server to apply it", LogFields{"key": key})
+	}
+	if provider, ok := c.permissionProvider.(*FilePermissionProvider); ok {
+		if err := provider.Reload(); err != nil {
+			c.Log(LevelError, "Can't reload permissions", LogFields{"error": err})
+		}
+		c.UpdateCommands()
+	}
+	c.Log(LevelInfo, "Config reloaded", nil)
+	c.CallEvent(&ConfigReloadEvent{old, config, restartRequired})
+	return nil
+}
+
+// revertRawConfig sets the given keys of the raw configuration to their
+// value in config, so that GetConfig reports the settings in effect while
+// keeping the keys of the plugins.
+func revertRawConfig(raw []byte, config *Config, keys []string) ([]byte, error) {
+	if len(keys) == 0 {
+		return raw, nil
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	typed, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(typed, &values); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		fields[key] = values[key]
+	}
+	return json.Marshal(fields)
+}
+
+func (c *Core) watchConfig() {
+	if !c.getConfig().WatchConfig {
+		return
+	}
+	info, err := os.Stat(c.configPath)
 	if err != nil {
-		panic(err)
+		return
 	}
-	if err := json.Unmarshal(file, config); err != nil {
-		panic(err)
+	c.configMutex.Lock()
+	changed := info.ModTime().After(c.configModTime)
+	c.configMutex.Unlock()
+	if changed {
+		if err := c.ReloadConfig(); err != nil {
+			c.Log(LevelError, "Can't reload config", LogFields{"error": err})
+		}
 	}
 }
@@ -0,0 +1,182 @@
+package typhoon
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigValidateDefault(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Log("Default config is invalid:", err)
+		t.Fail()
+	}
+}
+
+func TestConfigValidateErrors(t *testing.T) {
+	cases := map[string]func(*Config){
+		"missing port":       func(c *Config) { c.ListenAddress = "localhost" },
+		"port out of range":  func(c *Config) { c.ListenAddress = ":70000" },
+		"port not a number":  func(c *Config) { c.ListenAddress = ":mc" },
+		"negative players":   func(c *Config) { c.MaxPlayers = -1 },
+		"negative threshold": func(c *Config) { c.Threshold = -1 },
+		"empty name buffer":  func(c *Config) { c.BufferConfig.PlayerName = 0 },
+	}
+	for name, mutate := range cases {
+		config := DefaultConfig()
+		mutate(&config)
+		if err := config.Validate(); err == nil {
+			t.Log("Invalid config accepted:", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestInitWithConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Motd = "Embedded"
+	config.Favicon = ""
+
+	c, err := InitWithConfig(config, WithBrand("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.brand != "test" {
+		t.Log("Brand option not applied")
+		t.Fail()
+	}
+
+	var plugin struct {
+		Motd string `json:"motd"`
+	}
+	if err := c.GetConfig(&plugin); err != nil || plugin.Motd != "Embedded" {
+		t.Log("GetConfig returned", plugin.Motd, err)
+		t.Fail()
+	}
+
+	config.Threshold = -5
+	if _, err := InitWithConfig(config); err == nil {
+		t.Log("InitWithConfig accepted an invalid config")
+		t.Fail()
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event *ConfigReloadEvent
+	c.On(func(e *ConfigReloadEvent) {
+		event = e
+	})
+
+	config.Motd = "Reloaded"
+	config.MaxPlayers = 5
+	if err := c.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if c.getConfig().Motd != "Reloaded" || c.getConfig().MaxPlayers != 5 {
+		t.Log("Config was not swapped")
+		t.Fail()
+	}
+	if event == nil || event.Old.Motd != "Typhoon server" || event.New.Motd != "Reloaded" {
+		t.Log("ConfigReloadEvent not fired with old and new values")
+		t.Fail()
+	}
+
+	config.MaxPlayers = -1
+	if err := c.SetConfig(config); err == nil {
+		t.Log("SetConfig accepted an invalid config")
+		t.Fail()
+	}
+	if c.getConfig().MaxPlayers != 5 {
+		t.Log("Invalid config was applied")
+		t.Fail()
+	}
+}
+
+func TestWatchConfigBrokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "typhoon-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"favicon": "", "watch_config": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logger := &recordLogger{}
+	c, err := InitFromFile(path, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"favicon": "",`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	c.watchConfig()
+	c.watchConfig()
+	failures := 0
+	for _, entry := range logger.entries {
+		if entry.message == "Can't reload config" {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Log("Broken config reloaded", failures, "times")
+		t.Fail()
+	}
+}
+
+func TestReloadConfigRestartRequired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "typhoon-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"favicon": "", "listen_address": ":25565", "plugin": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := InitFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c.listener = ln
+
+	if err := ioutil.WriteFile(path, []byte(`{"favicon": "", "listen_address": ":25566", "motd": "Reloaded", "plugin": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		ListenAddress string `json:"listen_address"`
+		Motd          string `json:"motd"`
+		Plugin        int    `json:"plugin"`
+	}
+	if err := c.GetConfig(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if c.getConfig().ListenAddress != ":25565" || raw.ListenAddress != ":25565" || raw.Motd != "Reloaded" || raw.Plugin != 2 {
+		t.Log("Raw config differs from the config in effect", c.getConfig().ListenAddress, raw)
+		t.Fail()
+	}
+}
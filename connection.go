@@ -3,10 +3,12 @@ package typhoon
 import (
 	"bytes"
 	"compress/zlib"
-	"encoding/binary"
 	"fmt"
-	"log"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type State int8
@@ -18,6 +20,20 @@ const (
 	PLAY
 )
 
+func (state State) String() string {
+	switch state {
+	case HANDSHAKING:
+		return "HANDSHAKING"
+	case STATUS:
+		return "STATUS"
+	case LOGIN:
+		return "LOGIN"
+	case PLAY:
+		return "PLAY"
+	}
+	return fmt.Sprintf("State(%d)", int8(state))
+}
+
 type Gamemode uint8
 
 const (
@@ -93,6 +109,16 @@ const (
 	BOSSBAR_20NOTCHES
 )
 
+type PlayerListAction int
+
+const (
+	PLAYERLIST_ADD PlayerListAction = iota
+	PLAYERLIST_UPDATE_GAMEMODE
+	PLAYERLIST_UPDATE_LATENCY
+	PLAYERLIST_UPDATE_DISPLAY_NAME
+	PLAYERLIST_REMOVE
+)
+
 type LevelType string
 
 const (
@@ -167,6 +193,30 @@ var (
 	}
 )
 
+// versionNames are the game versions of the built-in protocols.
+var versionNames = map[Protocol]string{
+	V1_7_2: "1.7.2", V1_7_6: "1.7.6",
+	V1_8: "1.8",
+	V1_9: "1.9", V1_9_1: "1.9.1", V1_9_2: "1.9.2", V1_9_3: "1.9.3",
+	V1_10: "1.10",
+	V1_11: "1.11", V1_11_1: "1.11.1",
+	V1_12: "1.12", V1_12_1: "1.12.1",
+	V1_12_2: "1.12.2",
+	V1_13:   "1.13",
+	V1_13_1: "1.13.1",
+	V1_13_2: "1.13.2",
+	V1_14:   "1.14",
+	V1_14_1: "1.14.1",
+	V1_14_2: "1.14.2",
+	V1_14_3: "1.14.3",
+	V1_14_4: "1.14.4",
+	V1_15:   "1.15",
+	V1_15_1: "1.15.1",
+}
+
+// IsCompatible reports whether proto is one of the built-in protocols.
+// Protocols added by protocol-map modules are only known to the Core
+// that loaded them, see Core.IsCompatible.
 func IsCompatible(proto Protocol) bool {
 	for _, x := range COMPATIBLE_PROTO {
 		if x == proto {
@@ -176,8 +226,39 @@ func IsCompatible(proto Protocol) bool {
 	return false
 }
 
-func registerProtocol(proto Protocol) {
-	COMPATIBLE_PROTO = append(COMPATIBLE_PROTO, proto)
+func (c *Core) IsCompatible(proto Protocol) bool {
+	for _, x := range c.protocols {
+		if x == proto {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Core) GetCompatibleProtocols() []Protocol {
+	protocols := make([]Protocol, len(c.protocols))
+	copy(protocols, c.protocols)
+	return protocols
+}
+
+func (c *Core) registerProtocol(proto Protocol, name string) {
+	c.protocols = append(c.protocols, proto)
+	c.versionNames[proto] = name
+}
+
+// versionName returns the game version of the newest protocol the core
+// speaks, or its number when the version is unknown.
+func (c *Core) versionName() string {
+	newest := c.protocols[0]
+	for _, proto := range c.protocols {
+		if proto > newest {
+			newest = proto
+		}
+	}
+	if name := c.versionNames[newest]; name != "" {
+		return name
+	}
+	return strconv.Itoa(int(newest))
 }
 
 type InAddr struct {
@@ -186,17 +267,37 @@ type InAddr struct {
 }
 
 type Player struct {
-	core        *Core
-	id          int
-	conn        net.Conn
-	io          *ConnReadWrite
-	state       State
-	protocol    Protocol
-	inaddr      InAddr
-	name        string
-	uuid        string
-	keepalive   int
-	compression bool
+	core             *Core
+	id               int
+	conn             net.Conn
+	io               *ConnReadWrite
+	out              *ConnReadWrite
+	writeMutex       *sync.Mutex
+	joined           bool            // JoinGame was sent, guarded by writeMutex
+	playerList       map[string]bool // UUIDs of the tab list, guarded by writeMutex
+	state            int32           // State, accessed atomically
+	protocol         Protocol
+	inaddr           InAddr
+	virtualHost      string
+	name             string
+	uuid             string
+	connected        time.Time
+	packetBucket     tokenBucket
+	keepalive        int32
+	keepaliveSent    int64
+	ping             int64
+	permissions      PermissionSet
+	permissionsMutex *sync.RWMutex
+	compression      bool
+	threshold        int
+}
+
+func (player *Player) getState() State {
+	return State(atomic.LoadInt32(&player.state))
+}
+
+func (player *Player) setState(state State) {
+	atomic.StoreInt32(&player.state, int32(state))
 }
 
 func (player *Player) GetName() string {
@@ -225,17 +326,17 @@ func (player *Player) ReadPacketWithoutCompression() (packet Packet, err error)
 	if err != nil {
 		return
 	}
-	if player.state == PLAY {
+	if player.getState() == PLAY {
 		id = player.HackServerbound(id)
 	}
 
 	packet, err = player.HandlePacket(id, length)
 	if err != nil {
 		return
-	} else if packet != nil {
-		if config.Logs {
-			log.Printf("#%d -> %d %s", player.id, id, fmt.Sprint(packet))
-		}
+	}
+	player.core.metrics.packetReceived(packet, length+varIntSize(length))
+	if packet != nil {
+		player.tracePacket("in", id, packet, false)
 		packet.Handle(player)
 	}
 	return
@@ -246,12 +347,13 @@ func (player *Player) ReadPacketWithCompression() (packet Packet, err error) {
 	if err != nil {
 		return
 	}
+	size := packetLength + varIntSize(packetLength)
 
 	dataLength, err := player.ReadVarInt()
 	if err != nil {
 		return
 	}
-	dataLengthLength := binary.PutUvarint(player.io.buffer[:], uint64(dataLength))
+	dataLengthLength := varIntSize(dataLength)
 
 	var id int
 	var length int
@@ -261,20 +363,20 @@ func (player *Player) ReadPacketWithCompression() (packet Packet, err error) {
 		if err != nil {
 			return
 		}
-		idLength := binary.PutUvarint(player.io.buffer[:], uint64(id))
+		idLength := varIntSize(id)
 		length = packetLength - dataLengthLength - idLength
 
-		if player.state == PLAY {
+		if player.getState() == PLAY {
 			id = player.HackServerbound(id)
 		}
 		packet, err = player.HandlePacket(id, length)
 
 		if err != nil {
 			return
-		} else if packet != nil {
-			if config.Logs {
-				log.Printf("#%d u-> %d %s", player.id, id, fmt.Sprint(packet))
-			}
+		}
+		player.core.metrics.packetReceived(packet, size)
+		if packet != nil {
+			player.tracePacket("in", id, packet, false)
 			packet.Handle(player)
 		}
 	} else {
@@ -299,7 +401,7 @@ func (player *Player) ReadPacketWithCompression() (packet Packet, err error) {
 			return nil, err
 		}
 
-		if player.state == PLAY {
+		if player.getState() == PLAY {
 			id = player.HackServerbound(id)
 		}
 		packet, err = player.HandlePacket(id, length)
@@ -307,17 +409,26 @@ func (player *Player) ReadPacketWithCompression() (packet Packet, err error) {
 
 		if err != nil {
 			return nil, err
-		} else if packet != nil {
-			if config.Logs {
-				log.Printf("#%d c-> %d %s", player.id, id, fmt.Sprint(packet))
-			}
+		}
+		player.core.metrics.packetReceived(packet, size)
+		if packet != nil {
+			player.tracePacket("in", id, packet, true)
 			packet.Handle(player)
 		}
 	}
 	return
 }
 
+// WritePacket sends a packet to the player. It can be called from any
+// goroutine, the packets being written one at a time.
 func (player *Player) WritePacket(packet Packet) (err error) {
+	player.writeMutex.Lock()
+	defer player.writeMutex.Unlock()
+	return player.writePacket(packet)
+}
+
+// writePacket sends a packet with writeMutex held.
+func (player *Player) writePacket(packet Packet) (err error) {
 	if !player.compression {
 		return player.WritePacketWithoutCompression(packet)
 	} else {
@@ -327,14 +438,12 @@ func (player *Player) WritePacket(packet Packet) (err error) {
 
 func (player *Player) WritePacketWithoutCompression(packet Packet) (err error) {
 	buff := newVarBuffer(256)
-	tmp := player.io
-	player.io = &ConnReadWrite{
-		rdr: tmp.rdr,
+	player.out = &ConnReadWrite{
 		wtr: buff,
 	}
 
 	id, proto := packet.Id()
-	if player.state == PLAY {
+	if player.getState() == PLAY {
 		id = player.HackClientbound(id, proto)
 	}
 	if id == -1 {
@@ -344,28 +453,24 @@ func (player *Player) WritePacketWithoutCompression(packet Packet) (err error) {
 	packet.Write(player)
 
 	ln := newVarBuffer(0)
-	player.io.wtr = ln
+	player.out.wtr = ln
 	player.WriteVarInt(buff.Len())
-	player.io = tmp
 	player.conn.Write(ln.Bytes())
 	player.conn.Write(buff.Bytes())
+	player.core.metrics.packetSent(packet, ln.Len()+buff.Len())
 
-	if config.Logs {
-		log.Printf("#%d <- %d %s", player.id, id, fmt.Sprint(packet))
-	}
+	player.tracePacket("out", id, packet, false)
 	return nil
 }
 
 func (player *Player) WritePacketWithCompression(packet Packet) (err error) {
 	buff := newVarBuffer(256)
-	tmp := player.io
-	player.io = &ConnReadWrite{
-		rdr: tmp.rdr,
+	player.out = &ConnReadWrite{
 		wtr: buff,
 	}
 
 	id, proto := packet.Id()
-	if player.state == PLAY {
+	if player.getState() == PLAY {
 		id = player.HackClientbound(id, proto)
 	}
 	if id == -1 {
@@ -376,7 +481,7 @@ func (player *Player) WritePacketWithCompression(packet Packet) (err error) {
 
 	var rBuff []byte
 	var dataLength = 0
-	if buff.Len() < config.Threshold {
+	if buff.Len() < player.threshold {
 		rBuff = buff.Bytes()
 	} else {
 		var b bytes.Buffer
@@ -385,28 +490,23 @@ func (player *Player) WritePacketWithCompression(packet Packet) (err error) {
 		w.Close()
 		rBuff = b.Bytes()
 		dataLength = len(rBuff)
+		player.core.metrics.compressed(buff.Len(), len(rBuff))
 	}
 
 	buff2 := newVarBuffer(1)
-	player.io.wtr = buff2
+	player.out.wtr = buff2
 	player.WriteVarInt(dataLength)
 	packetLength := len(rBuff) + buff2.Len()
 
 	buff3 := newVarBuffer(1)
-	player.io.wtr = buff3
+	player.out.wtr = buff3
 	player.WriteVarInt(packetLength)
 
-	player.io = tmp
 	player.conn.Write(buff3.Bytes())
 	player.conn.Write(buff2.Bytes())
 	player.conn.Write(rBuff)
+	player.core.metrics.packetSent(packet, buff3.Len()+packetLength)
 
-	if config.Logs {
-		if buff.Len() < config.Threshold {
-			log.Println("<-u", id, packet)
-		} else {
-			log.Println("<-c", id, packet)
-		}
-	}
+	player.tracePacket("out", id, packet, dataLength != 0)
 	return nil
 }
@@ -0,0 +1,399 @@
+package typhoon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const consolePrompt = "> "
+
+type consoleKey int
+
+const (
+	consoleKeyIgnore consoleKey = iota
+	consoleKeyRune
+	consoleKeyEnter
+	consoleKeyBackspace
+	consoleKeyDelete
+	consoleKeyLeft
+	consoleKeyRight
+	consoleKeyUp
+	consoleKeyDown
+	consoleKeyHome
+	consoleKeyEnd
+	consoleKeyTab
+	consoleKeyClearLine
+	consoleKeyDeleteWord
+	consoleKeyInterrupt
+	consoleKeyEOF
+)
+
+// Console reads commands from the standard input and dispatches them as
+// the console sender. When the input is a terminal, it provides line
+// editing, history and tab completion, and keeps the prompt below the log
+// output.
+type Console struct {
+	core       *Core
+	in         *os.File
+	out        io.Writer
+	raw        bool
+	restore    func()
+	line       []rune
+	cursor     int
+	history    []string
+	historyPos int
+	mutex      *sync.Mutex
+}
+
+func newConsole(core *Core, in *os.File, out io.Writer) *Console {
+	return &Console{
+		core:       core,
+		in:         in,
+		out:        out,
+		raw:        false,
+		restore:    nil,
+		line:       make([]rune, 0),
+		cursor:     0,
+		history:    make([]string, 0),
+		historyPos: 0,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// WithConsole enables the interactive console once the core is started.
+func WithConsole() Option {
+	return func(c *Core) error {
+		c.terminal = newConsole(c, os.Stdin, os.Stdout)
+		return nil
+	}
+}
+
+func (console *Console) start() {
+	if restore, err := makeRaw(console.in.Fd()); err == nil {
+		console.raw = true
+		console.restore = restore
+	}
+	console.core.console.wtr = console
+	log.SetOutput(console)
+	go console.run()
+}
+
+func (console *Console) stop() {
+	console.mutex.Lock()
+	if console.raw {
+		io.WriteString(console.out, "\r\x1b[K")
+		console.restore()
+		console.raw = false
+	}
+	console.mutex.Unlock()
+	log.SetOutput(os.Stderr)
+}
+
+// Write prints p above the prompt, which makes the console usable as the
+// log output.
+func (console *Console) Write(p []byte) (int, error) {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+
+	if !console.raw {
+		return console.out.Write(p)
+	}
+	io.WriteString(console.out, "\r\x1b[K")
+	n, err := console.out.Write(p)
+	console.redraw()
+	return n, err
+}
+
+func (console *Console) redraw() {
+	buff := bytes.NewBufferString("\r\x1b[K")
+	buff.WriteString(consolePrompt)
+	buff.WriteString(string(console.line))
+	if back := len(console.line) - console.cursor; back > 0 {
+		fmt.Fprintf(buff, "\x1b[%dD", back)
+	}
+	console.out.Write(buff.Bytes())
+}
+
+func (console *Console) run() {
+	rdr := bufio.NewReader(console.in)
+	if !console.raw {
+		for {
+			line, err := rdr.ReadString('\n')
+			if len(line) > 0 {
+				console.execute(strings.TrimRight(line, "\r\n"))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	console.mutex.Lock()
+	console.redraw()
+	console.mutex.Unlock()
+
+	for {
+		key, r, err := readConsoleKey(rdr)
+		if err != nil {
+			return
+		}
+
+		console.mutex.Lock()
+		if !console.raw {
+			console.mutex.Unlock()
+			return
+		}
+		switch key {
+		case consoleKeyEnter:
+			line := string(console.line)
+			io.WriteString(console.out, "\r\x1b[K"+consolePrompt+line+"\n")
+			console.line = console.line[:0]
+			console.cursor = 0
+			if line != "" && (len(console.history) == 0 || console.history[len(console.history)-1] != line) {
+				console.history = append(console.history, line)
+			}
+			console.historyPos = len(console.history)
+			console.mutex.Unlock()
+
+			console.execute(line)
+
+			console.mutex.Lock()
+			console.redraw()
+			console.mutex.Unlock()
+			continue
+		case consoleKeyInterrupt, consoleKeyEOF:
+			if key == consoleKeyEOF && len(console.line) > 0 {
+				break
+			}
+			console.mutex.Unlock()
+			go console.core.Shutdown(context.Background(), "")
+			return
+		case consoleKeyTab:
+			console.mutex.Unlock()
+			console.complete()
+			continue
+		default:
+			console.edit(key, r)
+		}
+		console.redraw()
+		console.mutex.Unlock()
+	}
+}
+
+func (console *Console) edit(key consoleKey, r rune) {
+	switch key {
+	case consoleKeyRune:
+		console.insert([]rune{r})
+	case consoleKeyBackspace:
+		if console.cursor > 0 {
+			console.line = append(console.line[:console.cursor-1], console.line[console.cursor:]...)
+			console.cursor--
+		}
+	case consoleKeyDelete:
+		if console.cursor < len(console.line) {
+			console.line = append(console.line[:console.cursor], console.line[console.cursor+1:]...)
+		}
+	case consoleKeyLeft:
+		if console.cursor > 0 {
+			console.cursor--
+		}
+	case consoleKeyRight:
+		if console.cursor < len(console.line) {
+			console.cursor++
+		}
+	case consoleKeyHome:
+		console.cursor = 0
+	case consoleKeyEnd:
+		console.cursor = len(console.line)
+	case consoleKeyClearLine:
+		console.line = append(console.line[:0], console.line[console.cursor:]...)
+		console.cursor = 0
+	case consoleKeyDeleteWord:
+		start := console.cursor
+		for start > 0 && console.line[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && console.line[start-1] != ' ' {
+			start--
+		}
+		console.line = append(console.line[:start], console.line[console.cursor:]...)
+		console.cursor = start
+	case consoleKeyUp:
+		if console.historyPos > 0 {
+			console.historyPos--
+			console.setLine(console.history[console.historyPos])
+		}
+	case consoleKeyDown:
+		if console.historyPos < len(console.history)-1 {
+			console.historyPos++
+			console.setLine(console.history[console.historyPos])
+		} else {
+			console.historyPos = len(console.history)
+			console.setLine("")
+		}
+	}
+}
+
+func (console *Console) insert(runes []rune) {
+	line := make([]rune, 0, len(console.line)+len(runes))
+	line = append(line, console.line[:console.cursor]...)
+	line = append(line, runes...)
+	line = append(line, console.line[console.cursor:]...)
+	console.line = line
+	console.cursor += len(runes)
+}
+
+func (console *Console) setLine(line string) {
+	console.line = []rune(line)
+	console.cursor = len(console.line)
+}
+
+// complete extends the word under the cursor with the longest prefix shared
+// by the suggestions of the command tree, listing them when it's ambiguous.
+// The suggestion providers run without the lock, as they may log through
+// the console.
+func (console *Console) complete() {
+	console.mutex.Lock()
+	line := string(console.line)
+	cursor := console.cursor
+	console.mutex.Unlock()
+
+	text := strings.TrimPrefix(string([]rune(line)[:cursor]), "/")
+	args := strings.Split(text, " ")
+	last := args[len(args)-1]
+
+	matches := make([]string, 0)
+	seen := make(map[string]bool)
+	_, suggestions := console.core.completeCommand(console.core.console, text)
+	for _, completion := range suggestions {
+		suggestion := completion.Text
+		if strings.Contains(suggestion, " ") || !strings.HasPrefix(suggestion, last) || seen[suggestion] {
+			continue
+		}
+		seen[suggestion] = true
+		matches = append(matches, suggestion)
+	}
+
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	if string(console.line) != line || console.cursor != cursor {
+		return
+	}
+	defer console.redraw()
+	if len(matches) == 0 {
+		io.WriteString(console.out, "\a")
+		return
+	}
+	sort.Strings(matches)
+
+	common := matches[0]
+	for _, match := range matches[1:] {
+		i := 0
+		for i < len(common) && i < len(match) && common[i] == match[i] {
+			i++
+		}
+		common = common[:i]
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	if len(common) > len(last) {
+		console.insert([]rune(common[len(last):]))
+	} else if len(matches) > 1 {
+		io.WriteString(console.out, "\r\x1b[K"+strings.Join(matches, "  ")+"\n")
+	}
+}
+
+func (console *Console) execute(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	console.core.DispatchCommand(console.core.console, line)
+}
+
+func readConsoleKey(rdr *bufio.Reader) (key consoleKey, r rune, err error) {
+	r, _, err = rdr.ReadRune()
+	if err != nil {
+		return
+	}
+	switch r {
+	case '\r', '\n':
+		return consoleKeyEnter, r, nil
+	case 0x7f, 0x08:
+		return consoleKeyBackspace, r, nil
+	case '\t':
+		return consoleKeyTab, r, nil
+	case 0x01:
+		return consoleKeyHome, r, nil
+	case 0x03:
+		return consoleKeyInterrupt, r, nil
+	case 0x04:
+		return consoleKeyEOF, r, nil
+	case 0x05:
+		return consoleKeyEnd, r, nil
+	case 0x15:
+		return consoleKeyClearLine, r, nil
+	case 0x17:
+		return consoleKeyDeleteWord, r, nil
+	case 0x1b:
+		return readConsoleEscape(rdr)
+	}
+	if r < 0x20 {
+		return consoleKeyIgnore, r, nil
+	}
+	return consoleKeyRune, r, nil
+}
+
+func readConsoleEscape(rdr *bufio.Reader) (key consoleKey, r rune, err error) {
+	b, err := rdr.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return consoleKeyIgnore, 0, err
+	}
+
+	// Parameters are followed by a final byte in the 0x40-0x7E range.
+	params := make([]byte, 0)
+	for {
+		b, err = rdr.ReadByte()
+		if err != nil {
+			return consoleKeyIgnore, 0, err
+		}
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+		params = append(params, b)
+	}
+
+	switch b {
+	case 'A':
+		return consoleKeyUp, 0, nil
+	case 'B':
+		return consoleKeyDown, 0, nil
+	case 'C':
+		return consoleKeyRight, 0, nil
+	case 'D':
+		return consoleKeyLeft, 0, nil
+	case 'H':
+		return consoleKeyHome, 0, nil
+	case 'F':
+		return consoleKeyEnd, 0, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return consoleKeyHome, 0, nil
+		case "3":
+			return consoleKeyDelete, 0, nil
+		case "4", "8":
+			return consoleKeyEnd, 0, nil
+		}
+	}
+	return consoleKeyIgnore, 0, nil
+}
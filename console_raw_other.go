@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package typhoon
+
+import "errors"
+
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("console: raw mode is not supported on this platform")
+}
@@ -0,0 +1,90 @@
+package typhoon
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleKeys(t *testing.T) {
+	rdr := bufio.NewReader(strings.NewReader("a\x1b[D\x1b[3~\x1b[1;5C\x1b[5~\x7f\r"))
+	expected := []consoleKey{
+		consoleKeyRune,
+		consoleKeyLeft,
+		consoleKeyDelete,
+		consoleKeyRight,
+		consoleKeyIgnore,
+		consoleKeyBackspace,
+		consoleKeyEnter,
+	}
+	for i, exp := range expected {
+		key, _, err := readConsoleKey(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != exp {
+			t.Log("Key", i, "decoded as", key, "instead of", exp)
+			t.Fail()
+		}
+	}
+}
+
+func TestConsoleComplete(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	c.DeclareCommand(CommandNodeLiteral("broadcast", nil, nil))
+	c.DeclareCommand(CommandNodeLiteral("ban", nil, nil))
+	c.DeclareCommand(CommandNodeLiteral("list", nil, nil))
+
+	out := &bytes.Buffer{}
+	console := newConsole(c, os.Stdin, out)
+
+	for _, r := range "br" {
+		console.edit(consoleKeyRune, r)
+	}
+	console.complete()
+	if string(console.line) != "broadcast " {
+		t.Logf("Completed %q instead of %q", string(console.line), "broadcast ")
+		t.Fail()
+	}
+
+	console.setLine("b")
+	console.complete()
+	if string(console.line) != "b" || !strings.Contains(out.String(), "ban  broadcast") {
+		t.Logf("Ambiguous completion gave %q and printed %q", string(console.line), out.String())
+		t.Fail()
+	}
+}
+
+func TestConsoleCompleteLogging(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	out := &bytes.Buffer{}
+	console := newConsole(c, os.Stdin, out)
+	c.DeclareCommand(CommandNodeLiteral("kill", []*CommandNode{
+		CommandNodeArgument("target", nil, &CommandParserString{Format: CommandParserStringFormatSingleWord}, nil).
+			Suggest(func(core *Core, sender CommandSender, arg string) []CommandSuggestion {
+				io.WriteString(console, "suggesting\n")
+				return []CommandSuggestion{{Text: "Notch"}}
+			}),
+	}, nil))
+
+	console.setLine("kill N")
+	done := make(chan bool)
+	go func() {
+		console.complete()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Log("Completion deadlocked on a provider writing to the console")
+		t.FailNow()
+	}
+	if string(console.line) != "kill Notch " {
+		t.Logf("Completed %q instead of %q", string(console.line), "kill Notch ")
+		t.Fail()
+	}
+}
@@ -1,7 +1,9 @@
 package typhoon
 
 import (
+	"net"
 	"reflect"
+	"time"
 )
 
 type EventCallback struct {
@@ -28,6 +30,25 @@ type PlayerChatEvent struct {
 	Message string
 }
 
+// PreCommandEvent is fired when a player, the console or RCON runs a
+// command, before it is parsed. Handlers can rewrite the command, without
+// its leading slash, or cancel it.
+type PreCommandEvent struct {
+	Sender    CommandSender
+	Command   string
+	Cancelled bool
+}
+
+// PostCommandEvent is fired once a command was handled. Success is false
+// when it could not be parsed, a cooldown was running or its executor
+// called CommandContext.Fail.
+type PostCommandEvent struct {
+	Sender   CommandSender
+	Command  string
+	Success  bool
+	Duration time.Duration
+}
+
 type PlayerClickType byte
 
 const (
@@ -40,6 +61,24 @@ type PlayerInteractEvent struct {
 	ClickType PlayerClickType
 }
 
+type ServerStopEvent struct {
+	Reason string
+}
+
+type ConfigReloadEvent struct {
+	Old             Config
+	New             Config
+	RestartRequired []string
+}
+
+// ConnectionThrottledEvent is fired when a connection is refused or dropped
+// by the throttle. Player is nil when the connection was refused on accept.
+type ConnectionThrottledEvent struct {
+	Address net.Addr
+	Player  *Player
+	Reason  ThrottleReason
+}
+
 type PluginMessageEvent struct {
 	Channel string
 	Data    []byte
@@ -77,8 +116,15 @@ func (c *Core) callEventInternal(callback interface{}, event Event) {
 }
 
 func (c *Core) CallEvent(event Event) {
-	typ := reflect.TypeOf(event)
-	for _, f := range c.eventHandlers[typ] {
+	handlers := c.eventHandlers[reflect.TypeOf(event)]
+	if len(handlers) == 0 {
+		return
+	}
+	start := time.Now()
+	defer func() {
+		c.metrics.eventHandled(event, time.Since(start))
+	}()
+	for _, f := range handlers {
 		if f.MetaData == nil {
 			c.callEventInternal(f.Callback, event)
 		} else {
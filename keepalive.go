@@ -0,0 +1,157 @@
+package typhoon
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/TyphoonMC/go.uuid"
+)
+
+// latencyUpdatePeriod is the number of ticks between two latency updates
+// of the tab list, the period of the vanilla server.
+const latencyUpdatePeriod = 600
+
+// keepAlive runs every second: it kicks the players that didn't answer
+// their keepalive within KeepAlive.Timeout and sends a new one to those
+// whose last keepalive is older than KeepAlive.Interval.
+func (c *Core) keepAlive(r *rand.Rand, now time.Time) {
+	config := c.getConfig().KeepAlive
+	interval := time.Duration(config.Interval) * time.Second
+	timeout := time.Duration(config.Timeout) * time.Second
+
+	// Kicks call events, so the registry must not stay locked.
+	for _, player := range c.playerRegistry.GetPlayers() {
+		if player.getState() != PLAY {
+			continue
+		}
+		sent := time.Unix(0, atomic.LoadInt64(&player.keepaliveSent))
+		if atomic.LoadInt32(&player.keepalive) != 0 {
+			if now.Sub(sent) > timeout {
+				player.kick(kickTimeout, "Timed out")
+			}
+			continue
+		}
+		if now.Sub(sent) < interval {
+			continue
+		}
+
+		id := r.Int31n(math.MaxInt32) + 1
+		atomic.StoreInt64(&player.keepaliveSent, now.UnixNano())
+		atomic.StoreInt32(&player.keepalive, id)
+		player.WritePacket(&PacketPlayKeepAlive{
+			Identifier: int(id),
+		})
+	}
+}
+
+// keepAliveAnswered updates the ping of the player with the round trip
+// time of its pending keepalive, smoothed like the vanilla server does.
+func (player *Player) keepAliveAnswered(id int, now time.Time) {
+	pending := atomic.LoadInt32(&player.keepalive)
+	if pending == 0 || int(pending) != id {
+		// Clients before 1.9 may answer late or send their own keepalives.
+		if player.protocol > V1_8 {
+			player.Kick("Invalid keepalive")
+		}
+		return
+	}
+	rtt := now.Sub(time.Unix(0, atomic.LoadInt64(&player.keepaliveSent)))
+	atomic.StoreInt32(&player.keepalive, 0)
+
+	ping := atomic.LoadInt64(&player.ping)
+	if ping == 0 {
+		ping = int64(rtt)
+	} else {
+		ping = (ping*3 + int64(rtt)) / 4
+	}
+	atomic.StoreInt64(&player.ping, ping)
+	player.core.metrics.keepAliveAnswered(rtt)
+}
+
+// GetPing returns the latency of the player measured with keepalives, or
+// zero until the first one is answered.
+func (player *Player) GetPing() time.Duration {
+	return time.Duration(atomic.LoadInt64(&player.ping))
+}
+
+// GetPlayerListEntry returns the tab list entry of the player, with its
+// measured latency.
+func (player *Player) GetPlayerListEntry() PlayerListEntry {
+	return PlayerListEntry{
+		UUID:        uuid.FromStringOrNil(player.uuid),
+		Name:        player.name,
+		Gamemode:    player.getJoinGame().Gamemode,
+		Ping:        int(player.GetPing() / time.Millisecond),
+		DisplayName: nil,
+	}
+}
+
+// UpdatePlayerList sends a tab list update to the player, one packet per
+// entry before 1.8. The server keeps the latency of the online players
+// added this way up to date.
+func (player *Player) UpdatePlayerList(action PlayerListAction, entries []PlayerListEntry) {
+	player.writeMutex.Lock()
+	player.writePlayerList(action, entries)
+	player.writeMutex.Unlock()
+}
+
+// writePlayerList is UpdatePlayerList with the write lock held.
+func (player *Player) writePlayerList(action PlayerListAction, entries []PlayerListEntry) {
+	for _, entry := range entries {
+		if action == PLAYERLIST_ADD {
+			if player.playerList == nil {
+				player.playerList = make(map[string]bool)
+			}
+			player.playerList[entry.UUID.String()] = true
+		} else if action == PLAYERLIST_REMOVE {
+			delete(player.playerList, entry.UUID.String())
+		}
+	}
+	if player.protocol > V1_7_6 {
+		player.writePacket(&PacketPlayPlayerListItem{action, entries})
+		return
+	}
+	for _, entry := range entries {
+		player.writePacket(&PacketPlayPlayerListItem{action, []PlayerListEntry{entry}})
+	}
+}
+
+// updateLatency sends the measured latency of the online players to the
+// tab lists they were added to.
+func (c *Core) updateLatency() {
+	for _, player := range c.playerRegistry.GetPlayers() {
+		player.writeMutex.Lock()
+		if player.joined && len(player.playerList) > 0 {
+			entries := make([]PlayerListEntry, 0, len(player.playerList))
+			for uid := range player.playerList {
+				if online := c.playerRegistry.GetPlayerByUUID(uid); online != nil {
+					entries = append(entries, online.GetPlayerListEntry())
+				}
+			}
+			if len(entries) > 0 {
+				player.writePlayerList(PLAYERLIST_UPDATE_LATENCY, entries)
+			}
+		}
+		player.writeMutex.Unlock()
+	}
+}
+
+// updateReadDeadline drops connections that stay silent for ReadTimeout
+// or miss their handshake or login deadline before reaching PLAY. Players
+// in PLAY are timed out by keepalives.
+func (player *Player) updateReadDeadline() {
+	if player.getState() == PLAY {
+		player.conn.SetReadDeadline(time.Time{})
+		return
+	}
+	deadline := player.connectionDeadline()
+	if timeout := player.core.getConfig().ReadTimeout; timeout > 0 {
+		read := time.Now().Add(time.Duration(timeout) * time.Second)
+		if deadline.IsZero() || read.Before(deadline) {
+			deadline = read
+		}
+	}
+	player.conn.SetReadDeadline(deadline)
+}
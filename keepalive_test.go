@@ -0,0 +1,129 @@
+package typhoon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TyphoonMC/go.uuid"
+)
+
+func TestKeepAlivePing(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := &Player{core: c, state: int32(PLAY), protocol: V1_8}
+	sent := time.Now()
+
+	player.keepalive = 42
+	player.keepaliveSent = sent.UnixNano()
+	player.keepAliveAnswered(7, sent.Add(10*time.Millisecond))
+	if player.keepalive != 42 || player.GetPing() != 0 {
+		t.Log("Unknown keepalive answered the pending one")
+		t.Fail()
+	}
+
+	player.keepAliveAnswered(42, sent.Add(100*time.Millisecond))
+	if player.keepalive != 0 || player.GetPing() != 100*time.Millisecond {
+		t.Log("Expected a 100ms ping, got", player.GetPing())
+		t.Fail()
+	}
+
+	player.keepalive = 43
+	player.keepAliveAnswered(43, sent.Add(20*time.Millisecond))
+	if player.GetPing() != 80*time.Millisecond {
+		t.Log("Expected a smoothed 80ms ping, got", player.GetPing())
+		t.Fail()
+	}
+	if entry := player.GetPlayerListEntry(); entry.Ping != 80 {
+		t.Log("Expected a 80ms tab list ping, got", entry.Ping)
+		t.Fail()
+	}
+}
+
+func TestKeepAliveTimeoutKick(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	conn, client := net.Pipe()
+	defer client.Close()
+	go io.Copy(ioutil.Discard, client)
+	player := &Player{core: c, conn: conn, state: int32(PLAY), protocol: V1_8, name: "Steve", uuid: OfflineUUID("Steve"),
+		writeMutex: &sync.Mutex{}, keepalive: 42}
+	player.register()
+
+	kicked := make(chan int, 1)
+	c.On(func(e *PlayerKickEvent) {
+		kicked <- c.GetPlayerRegistry().GetPlayerCount()
+	})
+	done := make(chan bool)
+	go func() {
+		c.keepAlive(rand.New(rand.NewSource(0)), time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Keepalive deadlocked on a kick event handler")
+	}
+	player.unregister()
+	select {
+	case count := <-kicked:
+		if count != 1 {
+			t.Log("Expected 1 player during the kick event, got", count)
+			t.Fail()
+		}
+	default:
+		t.Log("The timed out player wasn't kicked")
+		t.Fail()
+	}
+}
+
+func TestUpdateLatency(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	for protocol, expected := range map[Protocol]int{V1_7_6: 2, V1_8: 1} {
+		conn, client := net.Pipe()
+		player := &Player{core: c, conn: conn, state: int32(PLAY), protocol: protocol, name: "Steve", uuid: OfflineUUID("Steve"),
+			writeMutex: &sync.Mutex{}}
+		player.register()
+
+		frames := make(chan int)
+		go func() {
+			reader := bufio.NewReader(client)
+			count := 0
+			for {
+				length, err := binary.ReadUvarint(reader)
+				if err == nil {
+					_, err = io.CopyN(ioutil.Discard, reader, int64(length))
+				}
+				if err != nil {
+					frames <- count
+					return
+				}
+				count++
+			}
+		}()
+
+		c.updateLatency()
+		player.writeMutex.Lock()
+		player.joined = true
+		player.writeMutex.Unlock()
+		c.updateLatency()
+		offline := PlayerListEntry{UUID: uuid.FromStringOrNil(OfflineUUID("Notch")), Name: "Notch"}
+		player.UpdatePlayerList(PLAYERLIST_ADD, []PlayerListEntry{player.GetPlayerListEntry(), offline})
+		c.updateLatency()
+		conn.Close()
+		if count := <-frames; count != expected+1 {
+			t.Logf("Sent %d packets to a protocol %d player instead of %d", count, protocol, expected+1)
+			t.Fail()
+		}
+		player.unregister()
+	}
+}
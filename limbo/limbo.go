@@ -1,12 +1,27 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
 	t "github.com/TyphoonMC/TyphoonCore"
 )
 
 func main() {
-	core := t.Init()
-	core.SetBrand("Limbo")
+	configPath := flag.String("config", t.ConfigPath(), "path to the configuration file")
+	flag.Parse()
+
+	core, err := t.InitFromFile(*configPath, t.WithBrand("Limbo"), t.WithConsole(), t.WithSignals())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	declareAdminCommands(core)
+	core.DeclareAccessCommands()
+	core.DeclareCommand(core.HelpCommand())
 
 	//loadConfig(core)
 
@@ -37,5 +52,68 @@ func main() {
 		})
 	})
 
-	core.Start()
+	if err := core.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+const adminPermission = "limbo.admin"
+
+// adminCommands declares /list, /kick, /broadcast and /stop.
+type adminCommands struct {
+	core *t.Core
+}
+
+func (h *adminCommands) List(ctx *t.CommandContext) {
+	players := h.core.GetPlayerRegistry().GetPlayers()
+	names := make([]string, len(players))
+	for i, player := range players {
+		names[i] = player.GetName()
+	}
+	ctx.GetSender().SendMessage(t.ChatMessage(fmt.Sprintf("There are %d players online: %s", len(names), strings.Join(names, ", "))))
+}
+
+func (h *adminCommands) Kick(ctx *t.CommandContext, args struct {
+	Players []*t.Player `command:"player"`
+	Reason  string      `command:"reason,optional,message"`
+}) {
+	reason := "Kicked by an operator"
+	if args.Reason != "" {
+		reason = args.Reason
+	}
+	if len(args.Players) == 0 {
+		ctx.Fail("No player was found")
+		return
+	}
+	for _, player := range args.Players {
+		player.Kick(reason)
+		ctx.GetSender().SendMessage(t.ChatMessage("Kicked " + player.GetName() + ": " + reason))
+	}
+}
+
+func (h *adminCommands) Broadcast(ctx *t.CommandContext, args struct {
+	Message string `command:"message,greedy"`
+}) {
+	msg := t.BukkitMessageConvert("&d[" + ctx.GetSender().GetName() + "] " + args.Message)
+	h.core.GetPlayerRegistry().ForEachPlayer(func(player *t.Player) {
+		player.SendMessage(msg)
+	})
+	h.core.GetConsoleSender().SendMessage(msg)
+}
+
+func (h *adminCommands) Stop(ctx *t.CommandContext) {
+	go h.core.Shutdown(context.Background(), "")
+}
+
+func declareAdminCommands(core *t.Core) {
+	commands, err := t.CommandsFromHandler(&adminCommands{core})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, command := range commands {
+		core.DeclareCommand(command.RequirePermission(adminPermission))
+		if command.Name == "broadcast" {
+			core.DeclareAlias("bc", command)
+		}
+	}
 }
@@ -0,0 +1,173 @@
+package typhoon
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+type LogLevel int8
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (level LogLevel) String() string {
+	if name, ok := logLevelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", level)
+}
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, n := range logLevelNames {
+		if strings.EqualFold(n, name) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+func (level LogLevel) MarshalText() ([]byte, error) {
+	return []byte(level.String()), nil
+}
+
+func (level *LogLevel) UnmarshalText(text []byte) error {
+	parsed, err := ParseLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*level = parsed
+	return nil
+}
+
+// LogFields are the structured values attached to a log message, like the
+// connection ID or the player name.
+type LogFields map[string]interface{}
+
+// Logger receives every message logged by the core. Messages below the
+// configured log.level are filtered out before reaching it, except packet
+// traces which are enabled separately.
+type Logger interface {
+	Log(level LogLevel, message string, fields LogFields)
+}
+
+type stdLogger struct{}
+
+// Log writes the message through the standard log package, with the fields
+// sorted by key.
+func (stdLogger) Log(level LogLevel, message string, fields LogFields) {
+	log.Print(formatLogLine(level, message, fields))
+}
+
+func formatLogLine(level LogLevel, message string, fields LogFields) string {
+	buff := strings.Builder{}
+	buff.WriteString("[")
+	buff.WriteString(strings.ToUpper(level.String()))
+	buff.WriteString("] ")
+	buff.WriteString(message)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprint(fields[key])
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		buff.WriteString(" ")
+		buff.WriteString(key)
+		buff.WriteString("=")
+		buff.WriteString(value)
+	}
+	return buff.String()
+}
+
+func WithLogger(logger Logger) Option {
+	return func(c *Core) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+func (c *Core) GetLogger() Logger {
+	return c.logger
+}
+
+// Log sends a message to the logger if its level is at least the
+// configured log.level.
+func (c *Core) Log(level LogLevel, message string, fields LogFields) {
+	if level < c.getConfig().Log.Level {
+		return
+	}
+	c.logger.Log(level, message, fields)
+}
+
+func (player *Player) logFields(fields LogFields) LogFields {
+	merged := LogFields{
+		"conn":     player.id,
+		"protocol": int(player.protocol),
+		"state":    player.getState(),
+	}
+	if player.name != "" {
+		merged["player"] = player.name
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Log sends a message to the core logger with the connection ID, player
+// name, protocol and state of the player.
+func (player *Player) Log(level LogLevel, message string, fields LogFields) {
+	player.core.Log(level, message, player.logFields(fields))
+}
+
+func (player *Player) protocolError(err error) {
+	player.Log(LevelWarn, "Protocol error", LogFields{"error": err})
+}
+
+// tracePacket logs a packet going in the given direction ("in" or "out")
+// when its trace toggle is enabled in the configuration.
+func (player *Player) tracePacket(direction string, id int, packet Packet, compressed bool) {
+	config := player.core.getConfig()
+	trace := config.Log.Trace
+	if !config.Logs {
+		if (direction == "in" && !trace.Inbound) || (direction == "out" && !trace.Outbound) {
+			return
+		}
+		if len(trace.Packets) > 0 {
+			name := typeName(packet)
+			found := false
+			for _, p := range trace.Packets {
+				if p == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return
+			}
+		}
+	}
+	player.core.logger.Log(LevelDebug, "Packet "+direction, player.logFields(LogFields{
+		"id":         id,
+		"type":       typeName(packet),
+		"compressed": compressed,
+		"packet":     fmt.Sprint(packet),
+	}))
+}
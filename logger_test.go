@@ -0,0 +1,82 @@
+package typhoon
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type logEntry struct {
+	level   LogLevel
+	message string
+	fields  LogFields
+}
+
+type recordLogger struct {
+	entries []logEntry
+}
+
+func (l *recordLogger) Log(level LogLevel, message string, fields LogFields) {
+	l.entries = append(l.entries, logEntry{level, message, fields})
+}
+
+func TestLogLine(t *testing.T) {
+	line := formatLogLine(LevelWarn, "Kicked", LogFields{
+		"reason": "Timed out",
+		"conn":   3,
+		"player": "Steve",
+	})
+	expected := `[WARN] Kicked conn=3 player=Steve reason="Timed out"`
+	if line != expected {
+		t.Log("Expected", expected, "got", line)
+		t.Fail()
+	}
+}
+
+func TestLogLevelConfig(t *testing.T) {
+	config := DefaultConfig()
+	if err := json.Unmarshal([]byte(`{"log": {"level": "WARN"}}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Log.Level != LevelWarn {
+		t.Log("Expected warn level, got", config.Log.Level)
+		t.Fail()
+	}
+	if err := json.Unmarshal([]byte(`{"log": {"level": "verbose"}}`), &config); err == nil {
+		t.Log("Unknown level accepted")
+		t.Fail()
+	}
+}
+
+func TestPlayerLog(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Log.Level = LevelWarn
+	config.Log.Trace.Outbound = true
+	config.Log.Trace.Packets = []string{"PacketPlayKeepAlive"}
+	logger := &recordLogger{}
+	c, err := InitWithConfig(config, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := &Player{core: c, id: 7, state: int32(PLAY), protocol: V1_15_1, name: "Steve"}
+
+	player.Log(LevelInfo, "Filtered", nil)
+	player.Log(LevelWarn, "Kicked", LogFields{"reason": "Timed out"})
+	player.tracePacket("out", 0x21, &PacketPlayKeepAlive{}, false)
+	player.tracePacket("out", 0x0F, &PacketPlayMessage{}, false)
+	player.tracePacket("in", 0x0F, &PacketPlayKeepAlive{}, false)
+
+	if len(logger.entries) != 2 {
+		t.Fatal("Expected 2 entries, got", logger.entries)
+	}
+	entry := logger.entries[0]
+	if entry.message != "Kicked" || entry.fields["conn"] != 7 || entry.fields["player"] != "Steve" ||
+		entry.fields["state"] != PLAY || entry.fields["reason"] != "Timed out" {
+		t.Log("Invalid entry", entry)
+		t.Fail()
+	}
+	if logger.entries[1].fields["type"] != "PacketPlayKeepAlive" {
+		t.Log("Invalid trace", logger.entries[1])
+		t.Fail()
+	}
+}
@@ -0,0 +1,291 @@
+package typhoon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	keepAliveRttBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	eventLatencyBuckets = []float64{.00001, .0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+)
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+		count:   0,
+		sum:     0,
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Metrics collects the core statistics exposed in the Prometheus text
+// format, see Core.GetMetrics.
+type Metrics struct {
+	core                *Core
+	mutex               *sync.Mutex
+	connectionsAccepted uint64
+	packetsReceived     map[string]uint64
+	packetsSent         map[string]uint64
+	bytesReceived       uint64
+	bytesSent           uint64
+	compressionIn       uint64
+	compressionOut      uint64
+	keepAliveRtt        *histogram
+	eventLatency        map[string]*histogram
+	kicks               map[string]uint64
+	throttled           map[string]uint64
+}
+
+func newMetrics(core *Core) *Metrics {
+	return &Metrics{
+		core:                core,
+		mutex:               &sync.Mutex{},
+		connectionsAccepted: 0,
+		packetsReceived:     make(map[string]uint64),
+		packetsSent:         make(map[string]uint64),
+		bytesReceived:       0,
+		bytesSent:           0,
+		compressionIn:       0,
+		compressionOut:      0,
+		keepAliveRtt:        newHistogram(keepAliveRttBuckets),
+		eventLatency:        make(map[string]*histogram),
+		kicks:               make(map[string]uint64),
+		throttled:           make(map[string]uint64),
+	}
+}
+
+func (c *Core) GetMetrics() *Metrics {
+	return c.metrics
+}
+
+func typeName(value interface{}) string {
+	typ := reflect.TypeOf(value)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Name()
+}
+
+func (m *Metrics) connectionAccepted() {
+	m.mutex.Lock()
+	m.connectionsAccepted++
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) packetReceived(packet Packet, bytes int) {
+	name := "unknown"
+	if packet != nil {
+		name = typeName(packet)
+	}
+	m.mutex.Lock()
+	m.packetsReceived[name]++
+	m.bytesReceived += uint64(bytes)
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) packetSent(packet Packet, bytes int) {
+	name := typeName(packet)
+	m.mutex.Lock()
+	m.packetsSent[name]++
+	m.bytesSent += uint64(bytes)
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) compressed(uncompressed int, compressed int) {
+	m.mutex.Lock()
+	m.compressionIn += uint64(uncompressed)
+	m.compressionOut += uint64(compressed)
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) keepAliveAnswered(rtt time.Duration) {
+	m.mutex.Lock()
+	m.keepAliveRtt.observe(rtt.Seconds())
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) eventHandled(event Event, duration time.Duration) {
+	name := typeName(event)
+	m.mutex.Lock()
+	h, ok := m.eventLatency[name]
+	if !ok {
+		h = newHistogram(eventLatencyBuckets)
+		m.eventLatency[name] = h
+	}
+	h.observe(duration.Seconds())
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) playerKicked(category kickCategory) {
+	m.mutex.Lock()
+	m.kicks[string(category)]++
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) connectionThrottled(reason ThrottleReason) {
+	m.mutex.Lock()
+	m.throttled[string(reason)]++
+	m.mutex.Unlock()
+}
+
+func escapeLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return strings.Replace(value, `"`, `\"`, -1)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeMetricHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeLabeledCounters(w io.Writer, name string, label string, values map[string]uint64) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(key), values[key])
+	}
+}
+
+func writeHistogram(w io.Writer, name string, labels string, h *histogram) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition
+// format.
+func (m *Metrics) WritePrometheus(wtr io.Writer) error {
+	w := bufio.NewWriter(wtr)
+
+	online := make(map[string]uint64)
+	for _, player := range m.core.playerRegistry.GetPlayers() {
+		online[strconv.Itoa(int(player.protocol))]++
+	}
+
+	m.mutex.Lock()
+	writeMetricHeader(w, "typhoon_connections_accepted_total", "counter", "Number of accepted TCP connections.")
+	fmt.Fprintf(w, "typhoon_connections_accepted_total %d\n", m.connectionsAccepted)
+
+	writeMetricHeader(w, "typhoon_players_online", "gauge", "Number of players in the PLAY state by protocol version.")
+	writeLabeledCounters(w, "typhoon_players_online", "protocol", online)
+
+	writeMetricHeader(w, "typhoon_packets_received_total", "counter", "Number of packets received by type.")
+	writeLabeledCounters(w, "typhoon_packets_received_total", "type", m.packetsReceived)
+	writeMetricHeader(w, "typhoon_packets_sent_total", "counter", "Number of packets sent by type.")
+	writeLabeledCounters(w, "typhoon_packets_sent_total", "type", m.packetsSent)
+
+	writeMetricHeader(w, "typhoon_received_bytes_total", "counter", "Number of bytes received from players.")
+	fmt.Fprintf(w, "typhoon_received_bytes_total %d\n", m.bytesReceived)
+	writeMetricHeader(w, "typhoon_sent_bytes_total", "counter", "Number of bytes sent to players.")
+	fmt.Fprintf(w, "typhoon_sent_bytes_total %d\n", m.bytesSent)
+
+	writeMetricHeader(w, "typhoon_compression_input_bytes_total", "counter", "Number of bytes passed to zlib.")
+	fmt.Fprintf(w, "typhoon_compression_input_bytes_total %d\n", m.compressionIn)
+	writeMetricHeader(w, "typhoon_compression_output_bytes_total", "counter", "Number of bytes produced by zlib.")
+	fmt.Fprintf(w, "typhoon_compression_output_bytes_total %d\n", m.compressionOut)
+	ratio := 1.0
+	if m.compressionIn > 0 {
+		ratio = float64(m.compressionOut) / float64(m.compressionIn)
+	}
+	writeMetricHeader(w, "typhoon_compression_ratio", "gauge", "Compressed size over uncompressed size of compressed packets.")
+	fmt.Fprintf(w, "typhoon_compression_ratio %s\n", formatFloat(ratio))
+
+	writeMetricHeader(w, "typhoon_keepalive_rtt_seconds", "histogram", "Round trip time of answered keepalives.")
+	writeHistogram(w, "typhoon_keepalive_rtt_seconds", "", m.keepAliveRtt)
+
+	writeMetricHeader(w, "typhoon_event_handler_duration_seconds", "histogram", "Time spent calling the handlers of an event.")
+	events := make([]string, 0, len(m.eventLatency))
+	for event := range m.eventLatency {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	for _, event := range events {
+		writeHistogram(w, "typhoon_event_handler_duration_seconds", "event=\""+escapeLabel(event)+"\"", m.eventLatency[event])
+	}
+
+	writeMetricHeader(w, "typhoon_kicks_total", "counter", "Number of kicked players by category.")
+	writeLabeledCounters(w, "typhoon_kicks_total", "reason", m.kicks)
+
+	writeMetricHeader(w, "typhoon_connections_throttled_total", "counter", "Number of connections refused or dropped by the throttle by reason.")
+	writeLabeledCounters(w, "typhoon_connections_throttled_total", "reason", m.throttled)
+	m.mutex.Unlock()
+
+	writeMetricHeader(w, "typhoon_tps", "gauge", "Ticks per second over the last 100 ticks.")
+	fmt.Fprintf(w, "typhoon_tps %s\n", formatFloat(m.core.scheduler.GetTPS()))
+	writeMetricHeader(w, "typhoon_mspt", "gauge", "Average milliseconds per tick over the last 100 ticks.")
+	fmt.Fprintf(w, "typhoon_mspt %s\n", formatFloat(m.core.scheduler.GetMSPT()))
+
+	return w.Flush()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.WritePrometheus(w); err != nil {
+		m.core.Log(LevelWarn, "Can't write metrics", LogFields{"error": err})
+	}
+}
+
+func (c *Core) startMetrics() error {
+	config := c.getConfig().Metrics
+	ln, err := net.Listen("tcp", config.ListenAddress)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(config.Path, c.metrics)
+	server := &http.Server{Handler: mux}
+	c.connMutex.Lock()
+	c.metricsServer = server
+	c.connMutex.Unlock()
+	c.Log(LevelInfo, "Metrics listening", LogFields{"address": ln.Addr().String(), "path": config.Path})
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			c.Log(LevelError, "Metrics server stopped", LogFields{"error": err})
+		}
+	}()
+	return nil
+}
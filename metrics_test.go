@@ -0,0 +1,54 @@
+package typhoon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.On(func(e *ServerStopEvent) {})
+
+	m := c.GetMetrics()
+	m.connectionAccepted()
+	m.packetReceived(&PacketHandshake{}, 20)
+	m.packetReceived(nil, 5)
+	m.packetSent(&PacketPlayKeepAlive{}, 10)
+	m.compressed(400, 100)
+	m.keepAliveAnswered(30 * time.Millisecond)
+	m.playerKicked(kickBanned)
+	c.CallEvent(&ServerStopEvent{})
+
+	buff := bytes.NewBuffer(nil)
+	if err := m.WritePrometheus(buff); err != nil {
+		t.Fatal(err)
+	}
+	out := buff.String()
+	for _, line := range []string{
+		"typhoon_connections_accepted_total 1",
+		`typhoon_packets_received_total{type="PacketHandshake"} 1`,
+		`typhoon_packets_received_total{type="unknown"} 1`,
+		`typhoon_packets_sent_total{type="PacketPlayKeepAlive"} 1`,
+		"typhoon_received_bytes_total 25",
+		"typhoon_sent_bytes_total 10",
+		"typhoon_compression_ratio 0.25",
+		`typhoon_keepalive_rtt_seconds_bucket{le="0.025"} 0`,
+		`typhoon_keepalive_rtt_seconds_bucket{le="0.05"} 1`,
+		`typhoon_keepalive_rtt_seconds_bucket{le="+Inf"} 1`,
+		"typhoon_keepalive_rtt_seconds_count 1",
+		`typhoon_event_handler_duration_seconds_count{event="ServerStopEvent"} 1`,
+		`typhoon_kicks_total{reason="banned"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Log("Missing", line, "in", out)
+			t.Fail()
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/TyphoonMC/go.uuid"
-	"log"
+	"time"
 )
 
 type PacketHandshake struct {
@@ -17,23 +17,23 @@ type PacketHandshake struct {
 func (packet *PacketHandshake) Read(player *Player, length int) (err error) {
 	protocol, err := player.ReadVarInt()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	packet.Protocol = Protocol(protocol)
-	packet.Address, err = player.ReadStringLimited(config.BufferConfig.HandshakeAddress)
+	packet.Address, err = player.ReadStringLimited(player.core.getConfig().BufferConfig.HandshakeAddress)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	packet.Port, err = player.ReadUInt16()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	state, err := player.ReadVarInt()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	packet.State = State(state)
@@ -43,10 +43,11 @@ func (packet *PacketHandshake) Write(player *Player) (err error) {
 	return
 }
 func (packet *PacketHandshake) Handle(player *Player) {
-	player.state = packet.State
+	player.setState(packet.State)
 	player.protocol = packet.Protocol
 	player.inaddr.address = packet.Address
 	player.inaddr.port = packet.Port
+	player.virtualHost = player.core.matchVirtualHost(NormalizeHostname(packet.Address))
 }
 func (packet *PacketHandshake) Id() (int, Protocol) {
 	return 0x00, V1_10
@@ -61,21 +62,23 @@ func (packet *PacketStatusRequest) Write(player *Player) (err error) {
 	return
 }
 func (packet *PacketStatusRequest) Handle(player *Player) {
-	protocol := COMPATIBLE_PROTO[0]
-	if IsCompatible(player.protocol) {
+	core := player.core
+	protocol := core.protocols[0]
+	if core.IsCompatible(player.protocol) {
 		protocol = player.protocol
 	}
 
-	max_players := config.MaxPlayers
-	motd := config.Motd
+	config := core.getConfig()
+	max_players := player.getMaxPlayers()
+	motd := player.getMotd()
 
-	count := player.core.playerRegistry.GetPlayerCount()
+	count := player.getPlayerCount()
 	if max_players < count && !config.Restricted {
 		max_players = count
 	}
 
 	response := PacketStatusResponse{
-		Response: fmt.Sprintf(`{"version":{"name":"Typhoon","protocol":%d},"players":{"max":%d,"online":%d,"sample":[]},"description":{"text":"%s"},"favicon":"%s","modinfo":{"type":"FML","modList":[]}}`, protocol, max_players, count, JsonEscape(motd), JsonEscape(favicon)),
+		Response: fmt.Sprintf(`{"version":{"name":"Typhoon","protocol":%d},"players":{"max":%d,"online":%d,"sample":[]},"description":{"text":"%s"},"favicon":"%s","modinfo":{"type":"FML","modList":[]}}`, protocol, max_players, count, JsonEscape(motd), JsonEscape(player.getFavicon())),
 	}
 	player.WritePacket(&response)
 }
@@ -93,7 +96,7 @@ func (packet *PacketStatusResponse) Read(player *Player, length int) (err error)
 func (packet *PacketStatusResponse) Write(player *Player) (err error) {
 	err = player.WriteString(packet.Response)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -110,7 +113,7 @@ type PacketStatusPing struct {
 func (packet *PacketStatusPing) Read(player *Player, length int) (err error) {
 	packet.Time, err = player.ReadUInt64()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -118,7 +121,7 @@ func (packet *PacketStatusPing) Read(player *Player, length int) (err error) {
 func (packet *PacketStatusPing) Write(player *Player) (err error) {
 	err = player.WriteUInt64(packet.Time)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -135,9 +138,9 @@ type PacketLoginStart struct {
 }
 
 func (packet *PacketLoginStart) Read(player *Player, length int) (err error) {
-	packet.Username, err = player.ReadStringLimited(config.BufferConfig.PlayerName)
+	packet.Username, err = player.ReadStringLimited(player.core.getConfig().BufferConfig.PlayerName)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -146,40 +149,34 @@ func (packet *PacketLoginStart) Write(player *Player) (err error) {
 	return
 }
 
-var (
-	join_game = PacketPlayJoinGame{
-		EntityId:            0,
-		Gamemode:            SPECTATOR,
-		Dimension:           END,
-		HashedSeed:          0,
-		Difficulty:          NORMAL,
-		LevelType:           DEFAULT,
-		MaxPlayers:          0xFF,
-		ReducedDebug:        false,
-		EnableRespawnScreen: true,
-	}
-	position_look = PacketPlayerPositionLook{}
-)
-
 func (packet *PacketLoginStart) Handle(player *Player) {
-	if !IsCompatible(player.protocol) {
+	core := player.core
+	if !core.IsCompatible(player.protocol) {
 		player.Kick("Incompatible version")
 		return
 	}
 
-	max_players := config.MaxPlayers
+	config := core.getConfig()
+	max_players := player.getMaxPlayers()
 
-	count := player.core.playerRegistry.GetPlayerCount()
+	count := player.getPlayerCount()
 	if max_players <= count && config.Restricted {
 		player.Kick("Server is full")
+		return
 	}
 
 	player.name = packet.Username
+	player.uuid = OfflineUUID(player.name)
+	if reason, category := player.checkAccess(); reason != "" {
+		player.kick(category, reason)
+		return
+	}
 
 	if config.Compression && player.protocol >= V1_8 {
 		setCompression := PacketSetCompression{config.Threshold}
 		player.WritePacket(&setCompression)
 		player.compression = true
+		player.threshold = config.Threshold
 	}
 
 	success := PacketLoginSuccess{
@@ -187,17 +184,21 @@ func (packet *PacketLoginStart) Handle(player *Player) {
 		Username: player.name,
 	}
 	player.WritePacket(&success)
-	player.state = PLAY
-	player.register()
+	player.setState(PLAY)
+	for _, old := range player.register() {
+		old.kick(kickDuplicateLogin, "You logged in from another location")
+	}
 
-	player.WritePacket(&join_game)
-	player.WritePacket(&position_look)
+	player.WritePacket(player.getJoinGame())
+	player.WritePacket(&core.positionLook)
 
-	if player.protocol >= V1_13 {
-		player.WritePacket(&PacketPlayDeclareCommands{
-			player.core.compiledCommands,
-			0,
-		})
+	player.writeMutex.Lock()
+	player.joined = true
+	player.writeMutex.Unlock()
+	player.UpdateCommands()
+
+	if handler := core.virtualHostJoinHandler(player.virtualHost); handler != nil {
+		handler(player)
 	}
 
 	player.core.CallEvent(&PlayerJoinEvent{
@@ -218,7 +219,7 @@ func (packet *PacketLoginDisconnect) Read(player *Player, length int) (err error
 func (packet *PacketLoginDisconnect) Write(player *Player) (err error) {
 	err = player.WriteString(packet.Component)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -239,12 +240,12 @@ func (packet *PacketLoginSuccess) Read(player *Player, length int) (err error) {
 func (packet *PacketLoginSuccess) Write(player *Player) (err error) {
 	err = player.WriteString(packet.UUID)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteString(packet.Username)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -264,7 +265,7 @@ func (packet *PacketSetCompression) Read(player *Player, length int) (err error)
 func (packet *PacketSetCompression) Write(player *Player) (err error) {
 	err = player.WriteVarInt(packet.Threshold)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -279,9 +280,9 @@ type PacketPlayChat struct {
 }
 
 func (packet *PacketPlayChat) Read(player *Player, length int) (err error) {
-	packet.Message, err = player.ReadStringLimited(config.BufferConfig.ChatMessage)
+	packet.Message, err = player.ReadStringLimited(player.core.getConfig().BufferConfig.ChatMessage)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -305,25 +306,69 @@ func (packet *PacketPlayChat) Id() (int, Protocol) {
 	return 0x02, V1_10
 }
 
+// PacketPlayTabComplete answers a PacketPlayTabCompleteServerbound. Before
+// 1.13, only the text of the suggestions is sent, which replaces the last
+// word typed.
 type PacketPlayTabComplete struct {
-	Matches []string
+	TransactionId int
+	Start         int
+	Length        int
+	Suggestions   []CommandSuggestion
 }
 
 func (packet *PacketPlayTabComplete) Read(player *Player, length int) (err error) {
 	return
 }
 func (packet *PacketPlayTabComplete) Write(player *Player) (err error) {
-	err = player.WriteVarInt(len(packet.Matches))
+	if player.protocol >= V1_13 {
+		err = player.WriteVarInt(packet.TransactionId)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		err = player.WriteVarInt(packet.Start)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		err = player.WriteVarInt(packet.Length)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+	}
+	err = player.WriteVarInt(len(packet.Suggestions))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
-	for _, s := range packet.Matches {
-		err = player.WriteString(s)
+	for _, suggestion := range packet.Suggestions {
+		err = player.WriteString(suggestion.Text)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		if player.protocol < V1_13 {
+			continue
+		}
+		err = player.WriteBool(suggestion.Tooltip != nil)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
+		if suggestion.Tooltip != nil {
+			var tooltip string
+			tooltip, err = suggestion.Tooltip.JSON()
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+			err = player.WriteString(tooltip)
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+		}
 	}
 	return
 }
@@ -333,31 +378,45 @@ func (packet *PacketPlayTabComplete) Id() (int, Protocol) {
 }
 
 type PacketPlayTabCompleteServerbound struct {
+	TransactionId int
 	Text          string
 	AssumeCommand bool
 	Position      Position
 }
 
 func (packet *PacketPlayTabCompleteServerbound) Read(player *Player, length int) (err error) {
-	packet.Text, err = player.ReadStringLimited(config.BufferConfig.ChatMessage)
+	if player.protocol >= V1_13 {
+		packet.TransactionId, err = player.ReadVarInt()
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		packet.Text, err = player.ReadStringLimited(player.core.getConfig().BufferConfig.ChatMessage)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		return
+	}
+	packet.Text, err = player.ReadStringLimited(player.core.getConfig().BufferConfig.ChatMessage)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	packet.AssumeCommand, err = player.ReadBool()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	hasPosition, err := player.ReadBool()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if hasPosition {
 		packet.Position, err = player.ReadPosition()
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -367,10 +426,8 @@ func (packet *PacketPlayTabCompleteServerbound) Write(player *Player) (err error
 	return
 }
 func (packet *PacketPlayTabCompleteServerbound) Handle(player *Player) {
-	if len(packet.Text) > 0 {
-		if packet.Text[0] == '/' {
-			player.core.onTabCommand(player, packet.Text[1:len(packet.Text)])
-		}
+	if len(packet.Text) > 0 && packet.Text[0] == '/' {
+		player.core.onTabCommand(player, packet.TransactionId, packet.Text)
 	}
 }
 func (packet *PacketPlayTabCompleteServerbound) Id() (int, Protocol) {
@@ -384,7 +441,7 @@ type PacketPlayClientStatus struct {
 func (packet *PacketPlayClientStatus) Read(player *Player, length int) (err error) {
 	act, err := player.ReadVarInt()
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	packet.Action = ClientStatusAction(act)
@@ -411,13 +468,13 @@ func (packet *PacketPlayMessage) Read(player *Player, length int) (err error) {
 func (packet *PacketPlayMessage) Write(player *Player) (err error) {
 	err = player.WriteString(packet.Component)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if player.protocol > V1_7_6 {
 		err = player.WriteUInt8(uint8(packet.Position))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -444,44 +501,44 @@ func (packet *PacketBossBar) Read(player *Player, length int) (err error) {
 func (packet *PacketBossBar) Write(player *Player) (err error) {
 	err = player.WriteUUID(packet.UUID)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteVarInt(int(packet.Action))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if packet.Action == BOSSBAR_UPDATE_TITLE || packet.Action == BOSSBAR_ADD {
 		err = player.WriteString(packet.Title)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if packet.Action == BOSSBAR_UPDATE_HEALTH || packet.Action == BOSSBAR_ADD {
 		err = player.WriteFloat32(packet.Health)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if packet.Action == BOSSBAR_UPDATE_STYLE || packet.Action == BOSSBAR_ADD {
 		err = player.WriteVarInt(int(packet.Color))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 		err = player.WriteVarInt(int(packet.Division))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if packet.Action == BOSSBAR_UPDATE_STYLE || packet.Action == BOSSBAR_ADD {
 		err = player.WriteUInt8(packet.Flags)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -503,19 +560,19 @@ func (packet *PacketPlayDeclareCommands) Read(player *Player, length int) (err e
 func (packet *PacketPlayDeclareCommands) Write(player *Player) (err error) {
 	err = player.WriteVarInt(len(packet.Nodes))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	for _, n := range packet.Nodes {
 		err = (&n).writeTo(player)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	err = player.WriteVarInt(packet.RootIndex)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -534,7 +591,7 @@ func (packet *PacketPlayPluginMessage) Read(player *Player, length int) (err err
 	var read int
 	packet.Channel, read, err = player.ReadNStringLimited(20)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 
@@ -542,7 +599,7 @@ func (packet *PacketPlayPluginMessage) Read(player *Player, length int) (err err
 	if player.protocol < V1_8 {
 		sread, err := player.ReadUInt16()
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return err
 		}
 		dataLength = int(sread)
@@ -550,7 +607,7 @@ func (packet *PacketPlayPluginMessage) Read(player *Player, length int) (err err
 
 	packet.Data, err = player.ReadByteArray(dataLength)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -558,29 +615,30 @@ func (packet *PacketPlayPluginMessage) Read(player *Player, length int) (err err
 func (packet *PacketPlayPluginMessage) Write(player *Player) (err error) {
 	err = player.WriteString(packet.Channel)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if player.protocol < V1_8 {
 		err = player.WriteUInt16(uint16(len(packet.Data)))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return err
 		}
 	}
 	err = player.WriteByteArray(packet.Data)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
 }
 func (packet *PacketPlayPluginMessage) Handle(player *Player) {
 	if packet.Channel == "MC|Brand" || packet.Channel == "minecraft:brand" {
-		log.Printf("%s is using %s client", player.name, string(packet.Data))
-		buff := make([]byte, len(player.core.brand)+1)
-		length := binary.PutUvarint(buff, uint64(len(player.core.brand)))
-		copy(buff[length:], []byte(player.core.brand))
+		player.Log(LevelInfo, "Client brand", LogFields{"brand": string(packet.Data)})
+		brand := player.getBrand()
+		buff := make([]byte, len(brand)+1)
+		length := binary.PutUvarint(buff, uint64(len(brand)))
+		copy(buff[length:], []byte(brand))
 		player.WritePacket(&PacketPlayPluginMessage{
 			packet.Channel,
 			buff,
@@ -605,7 +663,7 @@ func (packet *PacketPlayDisconnect) Read(player *Player, length int) (err error)
 func (packet *PacketPlayDisconnect) Write(player *Player) (err error) {
 	err = player.WriteString(packet.Component)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -632,7 +690,7 @@ func (packet *PacketPlayKeepAlive) Read(player *Player, length int) (err error)
 		packet.Identifier, err = player.ReadVarInt()
 	}
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -646,25 +704,127 @@ func (packet *PacketPlayKeepAlive) Write(player *Player) (err error) {
 		err = player.WriteVarInt(packet.Identifier)
 	}
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
 }
 func (packet *PacketPlayKeepAlive) Handle(player *Player) {
-	if player.protocol > V1_8 {
-		if player.keepalive != packet.Identifier {
-			player.Kick("Invalid keepalive")
-		}
-	} else {
-		player.keepalive = packet.Identifier
-	}
-	player.keepalive = 0
+	player.keepAliveAnswered(packet.Identifier, time.Now())
 }
 func (packet *PacketPlayKeepAlive) Id() (int, Protocol) {
 	return 0x1F, V1_10
 }
 
+// PlayerListEntry is a player of the tab list. Only the fields used by
+// the action of the packet are written.
+type PlayerListEntry struct {
+	UUID        uuid.UUID
+	Name        string
+	Gamemode    Gamemode
+	Ping        int
+	DisplayName *string
+}
+
+// PacketPlayPlayerListItem updates the tab list. Before 1.8, an entry is
+// identified by its name and a packet carries only its first entry, see
+// Player.UpdatePlayerList.
+type PacketPlayPlayerListItem struct {
+	Action  PlayerListAction
+	Entries []PlayerListEntry
+}
+
+func (packet *PacketPlayPlayerListItem) Read(player *Player, length int) (err error) {
+	return
+}
+func (packet *PacketPlayPlayerListItem) Write(player *Player) (err error) {
+	if player.protocol <= V1_7_6 {
+		if len(packet.Entries) == 0 {
+			return
+		}
+		entry := packet.Entries[0]
+		err = player.WriteString(entry.Name)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		err = player.WriteBool(packet.Action != PLAYERLIST_REMOVE)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		err = player.WriteUInt16(uint16(entry.Ping))
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		return
+	}
+
+	err = player.WriteVarInt(int(packet.Action))
+	if err != nil {
+		player.protocolError(err)
+		return
+	}
+	err = player.WriteVarInt(len(packet.Entries))
+	if err != nil {
+		player.protocolError(err)
+		return
+	}
+	for _, entry := range packet.Entries {
+		err = player.WriteUUID(entry.UUID)
+		if err != nil {
+			player.protocolError(err)
+			return
+		}
+		if packet.Action == PLAYERLIST_ADD {
+			err = player.WriteString(entry.Name)
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+			err = player.WriteVarInt(0)
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+		}
+		if packet.Action == PLAYERLIST_ADD || packet.Action == PLAYERLIST_UPDATE_GAMEMODE {
+			err = player.WriteVarInt(int(entry.Gamemode))
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+		}
+		if packet.Action == PLAYERLIST_ADD || packet.Action == PLAYERLIST_UPDATE_LATENCY {
+			err = player.WriteVarInt(entry.Ping)
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+		}
+		if packet.Action == PLAYERLIST_ADD || packet.Action == PLAYERLIST_UPDATE_DISPLAY_NAME {
+			err = player.WriteBool(entry.DisplayName != nil)
+			if err != nil {
+				player.protocolError(err)
+				return
+			}
+			if entry.DisplayName != nil {
+				err = player.WriteString(*entry.DisplayName)
+				if err != nil {
+					player.protocolError(err)
+					return
+				}
+			}
+		}
+	}
+	return
+}
+func (packet *PacketPlayPlayerListItem) Handle(player *Player) {}
+func (packet *PacketPlayPlayerListItem) Id() (int, Protocol) {
+	return 0x2D, V1_10
+}
+
 type PacketPlayJoinGame struct {
 	EntityId            uint32
 	Gamemode            Gamemode
@@ -687,61 +847,61 @@ func (packet *PacketPlayJoinGame) Write(player *Player) (err error) {
 		err = player.WriteUInt32(packet.EntityId)
 	}
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteUInt8(uint8(packet.Gamemode))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteUInt32(uint32(packet.Dimension))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if player.protocol < V1_14 {
 		err = player.WriteUInt8(uint8(packet.Difficulty))
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if player.protocol >= V1_15 {
 		err = player.WriteUInt64(packet.HashedSeed)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	err = player.WriteUInt8(packet.MaxPlayers)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteString(string(packet.LevelType))
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if player.protocol >= V1_14 {
 		err = player.WriteVarInt(32)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if player.protocol > V1_7_6 {
 		err = player.WriteBool(packet.ReducedDebug)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
 	if player.protocol >= V1_15 {
 		err = player.WriteBool(packet.EnableRespawnScreen)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -768,38 +928,38 @@ func (packet *PacketPlayerPositionLook) Read(player *Player, length int) (err er
 func (packet *PacketPlayerPositionLook) Write(player *Player) (err error) {
 	err = player.WriteFloat64(packet.X)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteFloat64(packet.Y)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteFloat64(packet.Z)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteFloat32(packet.Yaw)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteFloat32(packet.Pitch)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteUInt8(packet.Flags)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if player.protocol > V1_8 {
 		err = player.WriteVarInt(packet.TeleportId)
 		if err != nil {
-			log.Print(err)
+			player.protocolError(err)
 			return
 		}
 	}
@@ -822,17 +982,17 @@ func (packet *PacketUpdateHealth) Read(player *Player, length int) (err error) {
 func (packet *PacketUpdateHealth) Write(player *Player) (err error) {
 	err = player.WriteFloat32(packet.Health)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteVarInt(packet.Food)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	err = player.WriteFloat32(packet.FoodSaturation)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -859,7 +1019,7 @@ func (packet *PacketPlayerListHeaderFooter) Write(player *Player) (err error) {
 	}
 	err = player.WriteString(str)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	if packet.Footer == nil {
@@ -869,7 +1029,7 @@ func (packet *PacketPlayerListHeaderFooter) Write(player *Player) (err error) {
 	}
 	err = player.WriteString(str)
 	if err != nil {
-		log.Print(err)
+		player.protocolError(err)
 		return
 	}
 	return
@@ -1,14 +1,9 @@
 package typhoon
 
 import (
-	"log"
 	"reflect"
 )
 
-var (
-	packets map[int64]reflect.Type = make(map[int64]reflect.Type)
-)
-
 type Packet interface {
 	Write(*Player) error
 	Read(*Player, int) error
@@ -20,25 +15,23 @@ func PacketTypeHash(state State, id int) int64 {
 	return int64(id) ^ (int64(state) << 32)
 }
 
-func initPackets() {
-	packets[PacketTypeHash(HANDSHAKING, 0x00)] = reflect.TypeOf((*PacketHandshake)(nil)).Elem()
-	packets[PacketTypeHash(STATUS, 0x00)] = reflect.TypeOf((*PacketStatusRequest)(nil)).Elem()
-	packets[PacketTypeHash(STATUS, 0x01)] = reflect.TypeOf((*PacketStatusPing)(nil)).Elem()
-	packets[PacketTypeHash(LOGIN, 0x00)] = reflect.TypeOf((*PacketLoginStart)(nil)).Elem()
-	packets[PacketTypeHash(PLAY, 0x01)] = reflect.TypeOf((*PacketPlayTabCompleteServerbound)(nil)).Elem()
-	packets[PacketTypeHash(PLAY, 0x02)] = reflect.TypeOf((*PacketPlayChat)(nil)).Elem()
-	packets[PacketTypeHash(PLAY, 0x03)] = reflect.TypeOf((*PacketPlayClientStatus)(nil)).Elem()
-	packets[PacketTypeHash(PLAY, 0x09)] = reflect.TypeOf((*PacketPlayPluginMessage)(nil)).Elem()
-	packets[PacketTypeHash(PLAY, 0x0B)] = reflect.TypeOf((*PacketPlayKeepAlive)(nil)).Elem()
+func (c *Core) initPackets() {
+	c.packets[PacketTypeHash(HANDSHAKING, 0x00)] = reflect.TypeOf((*PacketHandshake)(nil)).Elem()
+	c.packets[PacketTypeHash(STATUS, 0x00)] = reflect.TypeOf((*PacketStatusRequest)(nil)).Elem()
+	c.packets[PacketTypeHash(STATUS, 0x01)] = reflect.TypeOf((*PacketStatusPing)(nil)).Elem()
+	c.packets[PacketTypeHash(LOGIN, 0x00)] = reflect.TypeOf((*PacketLoginStart)(nil)).Elem()
+	c.packets[PacketTypeHash(PLAY, 0x01)] = reflect.TypeOf((*PacketPlayTabCompleteServerbound)(nil)).Elem()
+	c.packets[PacketTypeHash(PLAY, 0x02)] = reflect.TypeOf((*PacketPlayChat)(nil)).Elem()
+	c.packets[PacketTypeHash(PLAY, 0x03)] = reflect.TypeOf((*PacketPlayClientStatus)(nil)).Elem()
+	c.packets[PacketTypeHash(PLAY, 0x09)] = reflect.TypeOf((*PacketPlayPluginMessage)(nil)).Elem()
+	c.packets[PacketTypeHash(PLAY, 0x0B)] = reflect.TypeOf((*PacketPlayKeepAlive)(nil)).Elem()
 }
 
 func (player *Player) HandlePacket(id int, length int) (packet Packet, err error) {
-	typ := packets[PacketTypeHash(player.state, id)]
+	typ := player.core.packets[PacketTypeHash(player.getState(), id)]
 
 	if typ == nil {
-		if config.Logs {
-			log.Printf("%d -> Unknown packet #%d\n", player.id, id)
-		}
+		player.Log(LevelDebug, "Unknown packet", LogFields{"id": id})
 
 		var buff []byte
 		nbr := 0
@@ -0,0 +1,251 @@
+package typhoon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// PermissionSet maps permission nodes to their value. A node can be a
+// wildcard like "typhoon.command.*" or "*", the most specific node
+// matching a permission decides its value.
+type PermissionSet map[string]bool
+
+// Lookup returns the value of the most specific node matching the
+// permission, and whether one was found.
+func (set PermissionSet) Lookup(permission string) (bool, bool) {
+	if value, ok := set[permission]; ok {
+		return value, true
+	}
+	node := permission
+	for {
+		i := strings.LastIndexByte(node, '.')
+		if i < 0 {
+			break
+		}
+		node = node[:i]
+		if value, ok := set[node+".*"]; ok {
+			return value, true
+		}
+	}
+	value, ok := set["*"]
+	return value, ok
+}
+
+// parsePermissions converts a list of nodes to a set, a node starting with
+// "-" being denied.
+func parsePermissions(nodes []string) PermissionSet {
+	set := make(PermissionSet, len(nodes))
+	for _, node := range nodes {
+		if strings.HasPrefix(node, "-") {
+			set[node[1:]] = false
+		} else {
+			set[node] = true
+		}
+	}
+	return set
+}
+
+// PermissionProvider resolves the permissions of players. It returns
+// whether the permission is set for the player, and its value.
+type PermissionProvider interface {
+	GetPermission(player *Player, permission string) (value bool, ok bool)
+}
+
+type permissionGroupFile struct {
+	Inherits    []string `json:"inherits"`
+	Permissions []string `json:"permissions"`
+}
+
+type permissionUserFile struct {
+	Groups      []string `json:"groups"`
+	Permissions []string `json:"permissions"`
+}
+
+type permissionFile struct {
+	Groups  map[string]permissionGroupFile `json:"groups"`
+	Players map[string]permissionUserFile  `json:"players"`
+}
+
+// FilePermissionProvider reads groups and players from a JSON file:
+//
+//	{
+//	  "groups": {
+//	    "default": {"permissions": ["typhoon.command.help"]},
+//	    "admin": {"inherits": ["default"], "permissions": ["typhoon.command.*", "-typhoon.command.stop"]}
+//	  },
+//	  "players": {
+//	    "Steve": {"groups": ["admin"], "permissions": ["limbo.admin"]}
+//	  }
+//	}
+//
+// Players are keyed by name or UUID, and are all members of the "default"
+// group. A group overrides the groups it inherits, and the permissions of
+// a player override those of its groups.
+type FilePermissionProvider struct {
+	path    string
+	groups  map[string][]PermissionSet
+	players map[string][]PermissionSet
+	mutex   *sync.RWMutex
+}
+
+// NewFilePermissionProvider loads the permissions of the file at path.
+func NewFilePermissionProvider(path string) (*FilePermissionProvider, error) {
+	provider := &FilePermissionProvider{
+		path:    path,
+		groups:  make(map[string][]PermissionSet),
+		players: make(map[string][]PermissionSet),
+		mutex:   &sync.RWMutex{},
+	}
+	if err := provider.Reload(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// Reload reads the file again. A missing file grants no permission.
+func (provider *FilePermissionProvider) Reload() error {
+	file := permissionFile{}
+	if raw, err := ioutil.ReadFile(provider.path); err == nil {
+		if err := json.Unmarshal(raw, &file); err != nil {
+			return fmt.Errorf("%s: %s", provider.path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	groups := make(map[string][]PermissionSet, len(file.Groups))
+	for name := range file.Groups {
+		if _, err := resolvePermissionGroup(file.Groups, groups, name, nil); err != nil {
+			return fmt.Errorf("%s: %s", provider.path, err)
+		}
+	}
+	players := make(map[string][]PermissionSet, len(file.Players))
+	for key, user := range file.Players {
+		sets := []PermissionSet{parsePermissions(user.Permissions)}
+		for i := len(user.Groups) - 1; i >= 0; i-- {
+			group, ok := groups[user.Groups[i]]
+			if !ok {
+				return fmt.Errorf("%s: player %s is in unknown group %s", provider.path, key, user.Groups[i])
+			}
+			sets = append(sets, group...)
+		}
+		players[strings.ToLower(key)] = sets
+	}
+
+	provider.mutex.Lock()
+	provider.groups = groups
+	provider.players = players
+	provider.mutex.Unlock()
+	return nil
+}
+
+// resolvePermissionGroup returns the permissions of a group followed by
+// those of the groups it inherits, the first set matching a permission
+// deciding its value.
+func resolvePermissionGroup(file map[string]permissionGroupFile, groups map[string][]PermissionSet, name string, visiting []string) ([]PermissionSet, error) {
+	if sets, ok := groups[name]; ok {
+		return sets, nil
+	}
+	for _, visited := range visiting {
+		if visited == name {
+			return nil, fmt.Errorf("group %s inherits from itself", name)
+		}
+	}
+	group, ok := file[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown group %s", name)
+	}
+	sets := []PermissionSet{parsePermissions(group.Permissions)}
+	for i := len(group.Inherits) - 1; i >= 0; i-- {
+		inherited, err := resolvePermissionGroup(file, groups, group.Inherits[i], append(visiting, name))
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, inherited...)
+	}
+	groups[name] = sets
+	return sets, nil
+}
+
+func (provider *FilePermissionProvider) GetPermission(player *Player, permission string) (bool, bool) {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	sets, ok := provider.players[strings.ToLower(player.uuid)]
+	if !ok {
+		sets = provider.players[strings.ToLower(player.name)]
+	}
+	if group, ok := provider.groups["default"]; ok {
+		sets = append(sets[:len(sets):len(sets)], group...)
+	}
+	for _, set := range sets {
+		if value, ok := set.Lookup(permission); ok {
+			return value, true
+		}
+	}
+	return false, false
+}
+
+func WithPermissionProvider(provider PermissionProvider) Option {
+	return func(c *Core) error {
+		c.permissionProvider = provider
+		return nil
+	}
+}
+
+func (c *Core) GetPermissionProvider() PermissionProvider {
+	return c.permissionProvider
+}
+
+func (c *Core) loadPermissions(path string) error {
+	if path == "" {
+		c.permissionProvider = nil
+		return nil
+	}
+	provider, err := NewFilePermissionProvider(path)
+	if err != nil {
+		return err
+	}
+	c.permissionProvider = provider
+	return nil
+}
+
+// HasPermission reports whether the player was granted the permission,
+// by SetPermission or else by the permission provider. The empty
+// permission is granted to everyone.
+func (player *Player) HasPermission(permission string) bool {
+	if permission == "" {
+		return true
+	}
+	player.permissionsMutex.RLock()
+	value, ok := player.permissions.Lookup(permission)
+	player.permissionsMutex.RUnlock()
+	if ok {
+		return value
+	}
+	if provider := player.core.permissionProvider; provider != nil {
+		value, _ = provider.GetPermission(player, permission)
+	}
+	return value
+}
+
+// SetPermission grants or denies a permission node to the player until it
+// disconnects, overriding the permission provider, and resends its
+// commands.
+func (player *Player) SetPermission(node string, value bool) {
+	player.permissionsMutex.Lock()
+	player.permissions[node] = value
+	player.permissionsMutex.Unlock()
+	player.UpdateCommands()
+}
+
+func (player *Player) UnsetPermission(node string) {
+	player.permissionsMutex.Lock()
+	delete(player.permissions, node)
+	player.permissionsMutex.Unlock()
+	player.UpdateCommands()
+}
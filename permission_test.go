@@ -0,0 +1,219 @@
+package typhoon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type testSender struct {
+	permissions PermissionSet
+	messages    []string
+}
+
+func (sender *testSender) GetName() string {
+	return "test"
+}
+
+func (sender *testSender) SendMessage(message IChatComponent) {
+	sender.messages = append(sender.messages, ChatPlainText(message))
+}
+
+func (sender *testSender) HasPermission(permission string) bool {
+	value, _ := sender.permissions.Lookup(permission)
+	return value
+}
+
+func TestPermissionSetLookup(t *testing.T) {
+	set := parsePermissions([]string{"typhoon.command.*", "-typhoon.command.stop", "limbo.admin"})
+	for permission, expected := range map[string]bool{
+		"typhoon.command.ban":  true,
+		"typhoon.command.stop": false,
+		"limbo.admin":          true,
+		"limbo.admin.kick":     false,
+		"typhoon":              false,
+	} {
+		if value, _ := set.Lookup(permission); value != expected {
+			t.Log("Invalid value for", permission)
+			t.Fail()
+		}
+	}
+	if value, ok := parsePermissions([]string{"*"}).Lookup("anything.at.all"); !value || !ok {
+		t.Log("* must match every permission")
+		t.Fail()
+	}
+}
+
+func TestFilePermissionProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "typhoon-permissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "permissions.json")
+	err = ioutil.WriteFile(path, []byte(`{
+  "groups": {
+    "default": {"permissions": ["typhoon.command.help"]},
+    "moderator": {"inherits": ["default"], "permissions": ["typhoon.command.*", "-typhoon.command.ban-ip"]},
+    "admin": {"inherits": ["moderator"], "permissions": ["typhoon.command.ban-ip"]},
+    "helper": {"permissions": ["-typhoon.command.kick"]},
+    "operator": {"inherits": ["helper"], "permissions": ["typhoon.command.*"]}
+  },
+  "players": {
+    "steve": {"groups": ["moderator"], "permissions": ["-typhoon.command.ban"]},
+    "`+OfflineUUID("Alex")+`": {"groups": ["admin"]},
+    "notch": {"groups": ["operator"]}
+  }
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newCore(DefaultConfig(), "")
+	if err := c.loadPermissions(path); err != nil {
+		t.Fatal(err)
+	}
+	newPlayer := func(name string) *Player {
+		return &Player{core: c, name: name, uuid: OfflineUUID(name), permissions: make(PermissionSet), permissionsMutex: &sync.RWMutex{}}
+	}
+	steve, alex, guest, notch := newPlayer("Steve"), newPlayer("Alex"), newPlayer("Guest"), newPlayer("Notch")
+
+	for _, test := range []struct {
+		player     *Player
+		permission string
+		expected   bool
+	}{
+		{guest, "typhoon.command.help", true},
+		{guest, "typhoon.command.pardon", false},
+		{steve, "typhoon.command.pardon", true},
+		{steve, "typhoon.command.ban", false},
+		{steve, "typhoon.command.ban-ip", false},
+		{alex, "typhoon.command.ban-ip", true},
+		{alex, "", true},
+		{notch, "typhoon.command.kick", true},
+	} {
+		if test.player.HasPermission(test.permission) != test.expected {
+			t.Log("Invalid permission", test.permission, "for", test.player.name)
+			t.Fail()
+		}
+	}
+
+	steve.SetPermission("typhoon.command.ban", true)
+	if !steve.HasPermission("typhoon.command.ban") {
+		t.Log("Player permissions must override the provider")
+		t.Fail()
+	}
+
+	err = ioutil.WriteFile(path, []byte(`{"groups": {"a": {"inherits": ["b"]}, "b": {"inherits": ["a"]}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.permissionProvider.(*FilePermissionProvider).Reload(); err == nil {
+		t.Log("Inheritance cycles must be refused")
+		t.Fail()
+	}
+}
+
+func TestCommandPermission(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	executed := false
+	c.DeclareCommand(CommandNodeLiteral("help", nil, func(ctx *CommandContext) {}))
+	c.DeclareCommand(CommandNodeLiteral("stop", nil, func(ctx *CommandContext) {
+		executed = true
+	}).RequirePermission("typhoon.command.stop"))
+
+	user := &testSender{permissions: PermissionSet{}}
+	if commands := c.compileCommands(user); len(commands) != 2 || commands[1].Name != "help" {
+		t.Log("Invalid compiled commands", commands)
+		t.Fail()
+	}
+	c.DispatchCommand(user, "stop")
+	if executed || len(user.messages) != 1 || user.messages[0] != commandUnknownCommand+"\nstop<--[HERE]" {
+		t.Log("Command executed without permission", user.messages)
+		t.Fail()
+	}
+
+	admin := &testSender{permissions: PermissionSet{"typhoon.command.*": true}}
+	if commands := c.compileCommands(admin); len(commands) != 3 {
+		t.Log("Invalid compiled commands", commands)
+		t.Fail()
+	}
+	c.DispatchCommand(admin, "stop")
+	if !executed {
+		t.Log("Command not executed with permission")
+		t.Fail()
+	}
+
+	visible := false
+	c.DeclareCommand(CommandNodeLiteral("hidden", nil, func(ctx *CommandContext) {}).Require(func(sender CommandSender) bool {
+		return visible
+	}))
+	if commands := c.compileCommands(admin); len(commands) != 3 {
+		t.Log("Node hidden by its predicate was compiled", commands)
+		t.Fail()
+	}
+	visible = true
+	if commands := c.compileCommands(admin); len(commands) != 4 {
+		t.Log("Node shown by its predicate was not compiled", commands)
+		t.Fail()
+	}
+}
+
+func TestUpdateCommandsConcurrent(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	conn, client := net.Pipe()
+	defer conn.Close()
+	player := &Player{core: c, conn: conn, state: int32(PLAY), protocol: V1_15_1, name: "Steve", uuid: OfflineUUID("Steve"),
+		permissions: make(PermissionSet), permissionsMutex: &sync.RWMutex{}, writeMutex: &sync.Mutex{}}
+	player.register()
+
+	frames := make(chan int)
+	go func() {
+		reader := bufio.NewReader(client)
+		count := 0
+		for {
+			length, err := binary.ReadUvarint(reader)
+			if err == nil {
+				_, err = io.CopyN(ioutil.Discard, reader, int64(length))
+			}
+			if err != nil {
+				frames <- count
+				return
+			}
+			count++
+		}
+	}()
+
+	c.DeclareCommand(CommandNodeLiteral("early", nil, func(ctx *CommandContext) {}))
+	player.writeMutex.Lock()
+	player.joined = true
+	player.writeMutex.Unlock()
+
+	const count = 20
+	wg := &sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(2)
+		name := "command" + strconv.Itoa(i)
+		go func() {
+			c.DeclareCommand(CommandNodeLiteral(name, nil, func(ctx *CommandContext) {}))
+			wg.Done()
+		}()
+		go func() {
+			player.SetPermission(name, true)
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	client.Close()
+	if n := <-frames; n != 2*count {
+		t.Log("Invalid packet count", n)
+		t.Fail()
+	}
+}
@@ -1,10 +1,19 @@
 package typhoon
 
-import "sync"
+import (
+	"crypto/md5"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/TyphoonMC/go.uuid"
+)
 
 type PlayerRegistry struct {
 	playersCount int
 	players      map[int]*Player
+	playersName  map[string]*Player
+	playersUUID  map[string]*Player
 	playersMutex *sync.RWMutex
 }
 
@@ -12,28 +21,63 @@ func newPlayerRegistry() *PlayerRegistry {
 	return &PlayerRegistry{
 		playersCount: 0,
 		players:      make(map[int]*Player),
+		playersName:  make(map[string]*Player),
+		playersUUID:  make(map[string]*Player),
 		playersMutex: &sync.RWMutex{},
 	}
 }
 
-func (player *Player) register() {
+// OfflineUUID returns the UUID given by vanilla servers in offline mode to
+// the player with the given name.
+func OfflineUUID(name string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	uid := uuid.FromBytesOrNil(sum[:])
+	uid.SetVersion(uuid.V3)
+	uid.SetVariant(uuid.VariantRFC4122)
+	return uid.String()
+}
+
+// register adds the player to the registry and returns the sessions that
+// were already using its name or UUID, which are removed from it.
+func (player *Player) register() []*Player {
 	reg := player.core.playerRegistry
 	reg.playersMutex.Lock()
+	duplicates := make([]*Player, 0)
+	for _, other := range []*Player{reg.playersName[strings.ToLower(player.name)], reg.playersUUID[player.uuid]} {
+		if other != nil && other != player && (len(duplicates) == 0 || duplicates[0] != other) {
+			duplicates = append(duplicates, other)
+			reg.remove(other)
+		}
+	}
 	reg.players[player.id] = player
+	reg.playersName[strings.ToLower(player.name)] = player
+	reg.playersUUID[player.uuid] = player
 	reg.playersCount++
 	reg.playersMutex.Unlock()
+	return duplicates
 }
 
 func (player *Player) unregister() {
 	reg := player.core.playerRegistry
 	reg.playersMutex.Lock()
-	if _, ok := reg.players[player.id]; ok {
-		reg.playersCount--
-	}
-	delete(reg.players, player.id)
+	reg.remove(player)
 	reg.playersMutex.Unlock()
 }
 
+func (registry *PlayerRegistry) remove(player *Player) {
+	if registry.players[player.id] != player {
+		return
+	}
+	registry.playersCount--
+	delete(registry.players, player.id)
+	if name := strings.ToLower(player.name); registry.playersName[name] == player {
+		delete(registry.playersName, name)
+	}
+	if registry.playersUUID[player.uuid] == player {
+		delete(registry.playersUUID, player.uuid)
+	}
+}
+
 func (registry *PlayerRegistry) ForEachPlayer(fn func(player *Player)) {
 	registry.playersMutex.Lock()
 	for _, player := range registry.players {
@@ -66,3 +110,37 @@ func (registry *PlayerRegistry) GetPlayers() []*Player {
 	registry.playersMutex.RUnlock()
 	return players
 }
+
+// GetPlayerByName returns the online player with the given name, ignoring
+// case, or nil.
+func (registry *PlayerRegistry) GetPlayerByName(name string) *Player {
+	registry.playersMutex.RLock()
+	player := registry.playersName[strings.ToLower(name)]
+	registry.playersMutex.RUnlock()
+	return player
+}
+
+func (registry *PlayerRegistry) GetPlayerByUUID(uid string) *Player {
+	registry.playersMutex.RLock()
+	player := registry.playersUUID[strings.ToLower(uid)]
+	registry.playersMutex.RUnlock()
+	return player
+}
+
+// GetPlayersByPrefix returns the online players whose name starts with the
+// given prefix, ignoring case, sorted by name.
+func (registry *PlayerRegistry) GetPlayersByPrefix(prefix string) []*Player {
+	prefix = strings.ToLower(prefix)
+	players := make([]*Player, 0)
+	registry.playersMutex.RLock()
+	for name, player := range registry.playersName {
+		if strings.HasPrefix(name, prefix) {
+			players = append(players, player)
+		}
+	}
+	registry.playersMutex.RUnlock()
+	sort.Slice(players, func(i, j int) bool {
+		return strings.ToLower(players[i].name) < strings.ToLower(players[j].name)
+	})
+	return players
+}
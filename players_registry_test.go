@@ -0,0 +1,66 @@
+package typhoon
+
+import (
+	"testing"
+)
+
+func TestOfflineUUID(t *testing.T) {
+	if uid := OfflineUUID("Notch"); uid != "b50ad385-829d-3141-a216-7e7d7539ba7f" {
+		t.Log("Invalid offline UUID", uid)
+		t.Fail()
+	}
+}
+
+func TestPlayerRegistryLookup(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := c.GetPlayerRegistry()
+	newPlayer := func(id int, name string) *Player {
+		return &Player{core: c, id: id, name: name, uuid: OfflineUUID(name)}
+	}
+
+	steve := newPlayer(1, "Steve")
+	stella := newPlayer(2, "stella")
+	alex := newPlayer(3, "Alex")
+	for _, player := range []*Player{steve, stella, alex} {
+		if duplicates := player.register(); len(duplicates) != 0 {
+			t.Fatal("Unexpected duplicates", duplicates)
+		}
+	}
+
+	if registry.GetPlayerByName("STEVE") != steve {
+		t.Log("Name lookup must ignore case")
+		t.Fail()
+	}
+	if registry.GetPlayerByUUID(alex.GetUUID()) != alex {
+		t.Log("UUID lookup failed")
+		t.Fail()
+	}
+	players := registry.GetPlayersByPrefix("ST")
+	if len(players) != 2 || players[0] != stella || players[1] != steve {
+		t.Log("Invalid prefix search", players)
+		t.Fail()
+	}
+
+	again := newPlayer(4, "steve")
+	duplicates := again.register()
+	if len(duplicates) != 1 || duplicates[0] != steve {
+		t.Log("The older session must be returned", duplicates)
+		t.Fail()
+	}
+	steve.unregister()
+	if registry.GetPlayerByName("Steve") != again || registry.GetPlayerCount() != 3 {
+		t.Log("Unregistering the older session removed the new one")
+		t.Fail()
+	}
+
+	alex.unregister()
+	if registry.GetPlayerByName("Alex") != nil || registry.GetPlayerByUUID(alex.GetUUID()) != nil {
+		t.Log("Indices were not cleared")
+		t.Fail()
+	}
+}
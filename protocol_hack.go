@@ -3,7 +3,6 @@ package typhoon
 import (
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -32,12 +31,10 @@ type Module struct {
 	Content Content `json:"content"`
 }
 
-var (
-	clientbound = make(map[Protocol]map[int]int)
-	serverbound = make(map[Protocol]map[int]int)
-)
+func (c *Core) initHacks() {
+	clientbound := c.clientbound
+	serverbound := c.serverbound
 
-func initHacks() {
 	// Hack 1.8
 	clientbound[V1_8] = make(map[int]int)
 	clientbound[V1_8][0x00] = 0x0E
@@ -182,7 +179,7 @@ func initHacks() {
 	// Hack 1.12.1
 	clientbound[V1_12_1] = copyHack(clientbound[V1_12])
 	for i := 0x2B; i <= 0x4E; i++ {
-		clientbound[V1_12_1][lastClientbound(V1_12, i)] = i + 1
+		clientbound[V1_12_1][c.lastClientbound(V1_12, i)] = i + 1
 	}
 
 	serverbound[V1_12_1] = copyHack(serverbound[V1_12])
@@ -196,20 +193,20 @@ func initHacks() {
 
 	// Hack 1.13
 	clientbound[V1_13] = copyHack(clientbound[V1_12_2])
-	clientbound[V1_13][lastClientbound(V1_12_2, 0x0F)] = 0x0E
-	clientbound[V1_13][lastClientbound(V1_12_2, 0x10)] = 0x0F
-	clientbound[V1_13][lastClientbound(V1_12_2, 0x0E)] = 0x10
+	clientbound[V1_13][c.lastClientbound(V1_12_2, 0x0F)] = 0x0E
+	clientbound[V1_13][c.lastClientbound(V1_12_2, 0x10)] = 0x0F
+	clientbound[V1_13][c.lastClientbound(V1_12_2, 0x0E)] = 0x10
 	for i := 0x11; i <= 0x1B; i++ {
-		clientbound[V1_13][lastClientbound(V1_12_2, i)] = i + 1
+		clientbound[V1_13][c.lastClientbound(V1_12_2, i)] = i + 1
 	}
 	for i := 0x1C; i <= 0x2E; i++ {
-		clientbound[V1_13][lastClientbound(V1_12_2, i)] = i + 2
+		clientbound[V1_13][c.lastClientbound(V1_12_2, i)] = i + 2
 	}
 	for i := 0x2F; i <= 0x48; i++ {
-		clientbound[V1_13][lastClientbound(V1_12_2, i)] = i + 3
+		clientbound[V1_13][c.lastClientbound(V1_12_2, i)] = i + 3
 	}
 	for i := 0x49; i <= 0x4F; i++ {
-		clientbound[V1_13][lastClientbound(V1_12_2, i)] = i + 4
+		clientbound[V1_13][c.lastClientbound(V1_12_2, i)] = i + 4
 	}
 
 	serverbound[V1_13] = copyHack(serverbound[V1_12_2])
@@ -242,66 +239,66 @@ func initHacks() {
 
 	// Hack 1.14
 	clientbound[V1_14] = copyHack(clientbound[V1_13_2])
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x14)] = 0x2E
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x15)] = 0x14
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x16)] = 0x15
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x17)] = 0x16
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x18)] = 0x17
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x19)] = 0x18
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x1A)] = 0x19
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x1B)] = 0x1A
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x1C)] = 0x1B
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x1D)] = 0x54
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x1E)] = 0x1C
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x1F)] = 0x1D
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x20)] = 0x1E
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x21)] = 0x20
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x22)] = 0x21
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x23)] = 0x22
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x24)] = 0x23
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x27)] = 0x2B
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x2B)] = 0x2C
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x2C)] = 0x2D
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x2D)] = 0x30
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x2E)] = 0x31
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x2F)] = 0x32
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x30)] = 0x33
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x31)] = 0x34
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x32)] = 0x35
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x34)] = 0x36
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x35)] = 0x37
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x36)] = 0x38
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x37)] = 0x39
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x38)] = 0x3A
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x39)] = 0x3B
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x3A)] = 0x3C
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x3B)] = 0x3D
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x3C)] = 0x3E
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x3D)] = 0x3F
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x3E)] = 0x42
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x3F)] = 0x43
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x40)] = 0x44
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x41)] = 0x45
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x42)] = 0x46
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x43)] = 0x47
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x44)] = 0x48
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x45)] = 0x49
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x46)] = 0x4A
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x47)] = 0x4B
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x48)] = 0x4C
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x49)] = 0x4D
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x4A)] = 0x4E
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x4B)] = 0x4F
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x4C)] = 0x52
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x4D)] = 0x51
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x4E)] = 0x53
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x4F)] = 0x55
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x50)] = 0x56
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x51)] = 0x57
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x52)] = 0x58
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x53)] = 0x59
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x54)] = 0x5A
-	clientbound[V1_14][lastClientbound(V1_13_2, 0x55)] = 0x5B
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x14)] = 0x2E
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x15)] = 0x14
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x16)] = 0x15
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x17)] = 0x16
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x18)] = 0x17
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x19)] = 0x18
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x1A)] = 0x19
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x1B)] = 0x1A
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x1C)] = 0x1B
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x1D)] = 0x54
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x1E)] = 0x1C
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x1F)] = 0x1D
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x20)] = 0x1E
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x21)] = 0x20
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x22)] = 0x21
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x23)] = 0x22
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x24)] = 0x23
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x27)] = 0x2B
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x2B)] = 0x2C
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x2C)] = 0x2D
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x2D)] = 0x30
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x2E)] = 0x31
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x2F)] = 0x32
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x30)] = 0x33
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x31)] = 0x34
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x32)] = 0x35
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x34)] = 0x36
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x35)] = 0x37
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x36)] = 0x38
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x37)] = 0x39
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x38)] = 0x3A
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x39)] = 0x3B
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x3A)] = 0x3C
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x3B)] = 0x3D
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x3C)] = 0x3E
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x3D)] = 0x3F
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x3E)] = 0x42
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x3F)] = 0x43
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x40)] = 0x44
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x41)] = 0x45
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x42)] = 0x46
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x43)] = 0x47
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x44)] = 0x48
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x45)] = 0x49
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x46)] = 0x4A
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x47)] = 0x4B
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x48)] = 0x4C
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x49)] = 0x4D
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x4A)] = 0x4E
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x4B)] = 0x4F
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x4C)] = 0x52
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x4D)] = 0x51
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x4E)] = 0x53
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x4F)] = 0x55
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x50)] = 0x56
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x51)] = 0x57
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x52)] = 0x58
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x53)] = 0x59
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x54)] = 0x5A
+	clientbound[V1_14][c.lastClientbound(V1_13_2, 0x55)] = 0x5B
 
 	serverbound[V1_14] = copyHack(serverbound[V1_13_2])
 	serverbound[V1_14][0x03] = serverbound[V1_13_2][0x02]
@@ -364,13 +361,13 @@ func initHacks() {
 
 	// Hack 1.15
 	clientbound[V1_15] = copyHack(clientbound[V1_14_4])
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x0E)] = 0x0F
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x10)] = 0x11
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x18)] = 0x19
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x1A)] = 0x1B
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x20)] = 0x21
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x25)] = 0x26
-	clientbound[V1_15][lastClientbound(V1_14_4, 0x35)] = 0x36
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x0E)] = 0x0F
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x10)] = 0x11
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x18)] = 0x19
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x1A)] = 0x1B
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x20)] = 0x21
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x25)] = 0x26
+	clientbound[V1_15][c.lastClientbound(V1_14_4, 0x35)] = 0x36
 
 	serverbound[V1_15] = copyHack(serverbound[V1_14_4])
 
@@ -378,7 +375,7 @@ func initHacks() {
 	clientbound[V1_15_1] = clientbound[V1_15]
 	serverbound[V1_15_1] = serverbound[V1_15]
 
-	initHackModules()
+	c.initHackModules()
 }
 
 func convUI(i string, v string) (uir int, uvr int, err error) {
@@ -393,17 +390,17 @@ func convUI(i string, v string) (uir int, uvr int, err error) {
 	return int(ui), int(uv), nil
 }
 
-func loadHackModule(module *Module) {
-	if IsCompatible(module.Content.Base) {
-		if clientbound[module.Content.Base] != nil {
-			clientbound[module.Content.Protocol] = copyHack(clientbound[module.Content.Base])
+func (c *Core) loadHackModule(module *Module) {
+	if c.IsCompatible(module.Content.Base) {
+		if c.clientbound[module.Content.Base] != nil {
+			c.clientbound[module.Content.Protocol] = copyHack(c.clientbound[module.Content.Base])
 		} else {
-			clientbound[module.Content.Protocol] = make(map[int]int)
+			c.clientbound[module.Content.Protocol] = make(map[int]int)
 		}
-		if serverbound[module.Content.Base] != nil {
-			serverbound[module.Content.Protocol] = copyHack(serverbound[module.Content.Base])
+		if c.serverbound[module.Content.Base] != nil {
+			c.serverbound[module.Content.Protocol] = copyHack(c.serverbound[module.Content.Base])
 		} else {
-			serverbound[module.Content.Protocol] = make(map[int]int)
+			c.serverbound[module.Content.Protocol] = make(map[int]int)
 		}
 
 		if module.Content.Base > V1_10 {
@@ -412,54 +409,55 @@ func loadHackModule(module *Module) {
 				if err != nil {
 					continue
 				}
-				clientbound[module.Content.Protocol][lastClientbound(module.Content.Base, ui)] = uv
+				c.clientbound[module.Content.Protocol][c.lastClientbound(module.Content.Base, ui)] = uv
 			}
 			for i, v := range module.Content.Map.Serverbound {
 				ui, uv, err := convUI(i, v)
 				if err != nil {
 					continue
 				}
-				serverbound[module.Content.Protocol][uv] = serverbound[module.Content.Base][ui]
+				c.serverbound[module.Content.Protocol][uv] = c.serverbound[module.Content.Base][ui]
 			}
 		}
 
-		registerProtocol(module.Content.Protocol)
-		log.Println("Added", module.Content.Name, "protocol fast support")
+		c.registerProtocol(module.Content.Protocol, module.Content.Name)
+		c.Log(LevelInfo, "Added protocol fast support", LogFields{"module": module.Content.Name})
 	}
 }
 
-func loadHackModuleFile(path string) {
+func (c *Core) loadHackModuleFile(path string) {
 	raw, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal("Can't read file", path)
+		c.Log(LevelError, "Can't read protocol module", LogFields{"path": path, "error": err})
 		return
 	}
 
 	var module Module
 	err = json.Unmarshal(raw, &module)
 	if err != nil {
+		c.Log(LevelError, "Can't parse protocol module", LogFields{"path": path, "error": err})
 		return
 	}
 
 	if module.Type.Name == "protocol-map" && module.Type.Version == 1 {
-		loadHackModule(&module)
+		c.loadHackModule(&module)
 	}
 }
 
-func initHackModules() {
+func (c *Core) initHackModules() {
 	err := filepath.Walk("modules", func(path string, info os.FileInfo, err error) error {
 		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".json") {
-			loadHackModuleFile(path)
+			c.loadHackModuleFile(path)
 		}
 		return nil
 	})
 	if err != nil {
-		log.Fatal("Can't find modules folder.")
+		c.Log(LevelError, "Can't read modules folder", LogFields{"error": err})
 	}
 }
 
-func lastClientbound(proto Protocol, i int) int {
-	for key, value := range clientbound[proto] {
+func (c *Core) lastClientbound(proto Protocol, i int) int {
+	for key, value := range c.clientbound[proto] {
 		if value == i {
 			return key
 		}
@@ -476,9 +474,9 @@ func copyHack(last map[int]int) map[int]int {
 }
 
 func (player *Player) HackServerbound(id int) int {
-	_, ok := serverbound[player.protocol]
+	_, ok := player.core.serverbound[player.protocol]
 	if ok {
-		if val, ok := serverbound[player.protocol][id]; ok {
+		if val, ok := player.core.serverbound[player.protocol][id]; ok {
 			return val
 		} else {
 			return id
@@ -492,9 +490,9 @@ func (player *Player) HackClientbound(id int, protocol Protocol) int {
 	if protocol != V1_10 {
 		return id
 	}
-	_, ok := clientbound[player.protocol]
+	_, ok := player.core.clientbound[player.protocol]
 	if ok {
-		if val, ok := clientbound[player.protocol][id]; ok {
+		if val, ok := player.core.clientbound[player.protocol][id]; ok {
 			return val
 		} else {
 			return id
@@ -0,0 +1,264 @@
+package typhoon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	queryTypeStat      = 0x00
+	queryTypeHandshake = 0x09
+
+	queryChallengeLifetime = 30 * time.Second
+)
+
+var (
+	queryMagic         = []byte{0xFE, 0xFD}
+	queryFullStatStart = []byte("splitnum\x00\x80\x00")
+	queryPlayersStart  = []byte("\x01player_\x00\x00")
+)
+
+type queryChallenge struct {
+	token   int32
+	created time.Time
+}
+
+type queryClient struct {
+	tokens float64
+	last   time.Time
+}
+
+// queryServer answers the GameSpy4 UDP query protocol used by server
+// lists, see https://wiki.vg/Query. Queries don't carry the hostname, so
+// the stats come from the main configuration, whatever the virtual hosts
+// override.
+type queryServer struct {
+	core        *Core
+	conn        net.PacketConn
+	challenges  map[string]queryChallenge
+	clients     map[string]*queryClient
+	mutex       *sync.Mutex
+	lastCleanup time.Time
+}
+
+func newQueryServer(core *Core) *queryServer {
+	return &queryServer{
+		core:        core,
+		conn:        nil,
+		challenges:  make(map[string]queryChallenge),
+		clients:     make(map[string]*queryClient),
+		mutex:       &sync.Mutex{},
+		lastCleanup: time.Now(),
+	}
+}
+
+func (c *Core) startQuery() error {
+	conn, err := net.ListenPacket("udp", c.getConfig().Query.ListenAddress)
+	if err != nil {
+		return err
+	}
+	query := newQueryServer(c)
+	query.conn = conn
+	c.connMutex.Lock()
+	c.query = query
+	c.connMutex.Unlock()
+	c.Log(LevelInfo, "Query listening", LogFields{"address": conn.LocalAddr().String()})
+	go query.serve()
+	return nil
+}
+
+func (s *queryServer) serve() {
+	buff := make([]byte, 1460)
+	for {
+		n, addr, err := s.conn.ReadFrom(buff)
+		if err != nil {
+			if s.core.isClosing() {
+				return
+			}
+			s.core.Log(LevelWarn, "Query read error", LogFields{"error": err})
+			continue
+		}
+		if response := s.handle(buff[:n], addr, time.Now()); response != nil {
+			s.conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func (s *queryServer) close() {
+	s.conn.Close()
+}
+
+func queryHost(addr net.Addr) string {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// handle returns the response to a query packet, or nil if it must be
+// ignored.
+func (s *queryServer) handle(packet []byte, addr net.Addr, now time.Time) []byte {
+	if len(packet) < 7 || !bytes.Equal(packet[:2], queryMagic) {
+		return nil
+	}
+	host := queryHost(addr)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cleanup(now)
+	if !s.allow(host, now) {
+		return nil
+	}
+
+	session := packet[3:7]
+	switch packet[2] {
+	case queryTypeHandshake:
+		token, err := randomQueryToken()
+		if err != nil {
+			s.core.Log(LevelError, "Can't generate query token", LogFields{"error": err})
+			return nil
+		}
+		s.challenges[addr.String()] = queryChallenge{token, now}
+
+		response := bytes.NewBuffer([]byte{queryTypeHandshake})
+		response.Write(session)
+		response.WriteString(strconv.Itoa(int(token)))
+		response.WriteByte(0)
+		return response.Bytes()
+	case queryTypeStat:
+		if len(packet) < 11 {
+			return nil
+		}
+		challenge, ok := s.challenges[addr.String()]
+		token := int32(binary.BigEndian.Uint32(packet[7:11]))
+		if !ok || challenge.token != token || now.Sub(challenge.created) > queryChallengeLifetime {
+			return nil
+		}
+
+		response := bytes.NewBuffer([]byte{queryTypeStat})
+		response.Write(session)
+		if len(packet) >= 15 {
+			s.writeFullStat(response)
+		} else {
+			s.writeBasicStat(response)
+		}
+		return response.Bytes()
+	}
+	return nil
+}
+
+// allow applies a token bucket of Query.RateLimit packets per second to
+// each source address.
+func (s *queryServer) allow(host string, now time.Time) bool {
+	limit := float64(s.core.getConfig().Query.RateLimit)
+	if limit <= 0 {
+		return true
+	}
+	client, ok := s.clients[host]
+	if !ok {
+		client = &queryClient{limit, now}
+		s.clients[host] = client
+	}
+	client.tokens += now.Sub(client.last).Seconds() * limit
+	if client.tokens > limit {
+		client.tokens = limit
+	}
+	client.last = now
+	if client.tokens < 1 {
+		return false
+	}
+	client.tokens--
+	return true
+}
+
+func (s *queryServer) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < queryChallengeLifetime {
+		return
+	}
+	s.lastCleanup = now
+	for addr, challenge := range s.challenges {
+		if now.Sub(challenge.created) > queryChallengeLifetime {
+			delete(s.challenges, addr)
+		}
+	}
+	for host, client := range s.clients {
+		if now.Sub(client.last) > queryChallengeLifetime {
+			delete(s.clients, host)
+		}
+	}
+}
+
+func randomQueryToken() (int32, error) {
+	buff := make([]byte, 4)
+	if _, err := rand.Read(buff); err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(buff) & 0x7FFFFFFF), nil
+}
+
+func (s *queryServer) hostAddress() (string, int) {
+	host, port, _ := net.SplitHostPort(s.core.getConfig().ListenAddress)
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	nb, _ := strconv.Atoi(port)
+	return host, nb
+}
+
+func writeQueryString(buff *bytes.Buffer, s string) {
+	buff.WriteString(s)
+	buff.WriteByte(0)
+}
+
+func (s *queryServer) writeBasicStat(buff *bytes.Buffer) {
+	config := s.core.getConfig()
+	host, port := s.hostAddress()
+
+	writeQueryString(buff, config.Motd)
+	writeQueryString(buff, "SMP")
+	writeQueryString(buff, "world")
+	writeQueryString(buff, strconv.Itoa(s.core.playerRegistry.GetPlayerCount()))
+	writeQueryString(buff, strconv.Itoa(config.MaxPlayers))
+	binary.Write(buff, binary.LittleEndian, uint16(port))
+	writeQueryString(buff, host)
+}
+
+func (s *queryServer) writeFullStat(buff *bytes.Buffer) {
+	config := s.core.getConfig()
+	host, port := s.hostAddress()
+	players := s.core.playerRegistry.GetPlayers()
+
+	buff.Write(queryFullStatStart)
+	for _, kv := range [][2]string{
+		{"hostname", config.Motd},
+		{"gametype", "SMP"},
+		{"game_id", "MINECRAFT"},
+		{"version", s.core.versionName()},
+		{"plugins", "Typhoon: " + s.core.brand},
+		{"map", "world"},
+		{"numplayers", strconv.Itoa(len(players))},
+		{"maxplayers", strconv.Itoa(config.MaxPlayers)},
+		{"hostport", strconv.Itoa(port)},
+		{"hostip", host},
+	} {
+		writeQueryString(buff, kv[0])
+		writeQueryString(buff, kv[1])
+	}
+	buff.WriteByte(0)
+
+	buff.Write(queryPlayersStart)
+	for _, player := range players {
+		writeQueryString(buff, player.GetName())
+	}
+	buff.WriteByte(0)
+}
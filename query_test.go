@@ -0,0 +1,103 @@
+package typhoon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func queryRequest(kind byte, token int32, full bool) []byte {
+	buff := bytes.NewBuffer([]byte{0xFE, 0xFD, kind, 0x00, 0x00, 0x00, 0x01})
+	if kind == queryTypeStat {
+		binary.Write(buff, binary.BigEndian, token)
+		if full {
+			buff.Write([]byte{0, 0, 0, 0})
+		}
+	}
+	return buff.Bytes()
+}
+
+func TestQueryStats(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Motd = "Query test"
+	c, err := InitWithConfig(config, WithBrand("Limbo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newQueryServer(c)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+	now := time.Now()
+
+	response := s.handle(queryRequest(queryTypeHandshake, 0, false), addr, now)
+	if len(response) < 6 || response[0] != queryTypeHandshake {
+		t.Fatal("Invalid handshake response", response)
+	}
+	token, err := strconv.Atoi(string(response[5 : len(response)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.handle(queryRequest(queryTypeStat, int32(token+1), false), addr, now) != nil {
+		t.Log("Stat answered with an invalid challenge token")
+		t.Fail()
+	}
+	port := &net.UDPAddr{IP: addr.IP, Port: 40001}
+	if s.handle(queryRequest(queryTypeStat, int32(token), false), port, now) != nil {
+		t.Log("Stat answered with the challenge token of another port")
+		t.Fail()
+	}
+
+	basic := s.handle(queryRequest(queryTypeStat, int32(token), false), addr, now)
+	if !bytes.HasPrefix(basic, []byte("\x00\x00\x00\x00\x01Query test\x00SMP\x00world\x000\x00100\x00")) {
+		t.Logf("Unexpected basic stat %q", basic)
+		t.Fail()
+	}
+
+	full := s.handle(queryRequest(queryTypeStat, int32(token), true), addr, now)
+	if !bytes.Contains(full, []byte("version\x001.15.1\x00plugins\x00Typhoon: Limbo\x00")) || !bytes.HasSuffix(full, []byte("\x01player_\x00\x00\x00")) {
+		t.Logf("Unexpected full stat %q", full)
+		t.Fail()
+	}
+
+	if s.handle(queryRequest(queryTypeStat, int32(token), false), addr, now.Add(time.Minute)) != nil {
+		t.Log("Stat answered with an expired challenge token")
+		t.Fail()
+	}
+}
+
+func TestQueryRateLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Query.RateLimit = 2
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newQueryServer(c)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 40000}
+	now := time.Now()
+
+	answered := 0
+	for i := 0; i < 5; i++ {
+		if s.handle(queryRequest(queryTypeHandshake, 0, false), addr, now) != nil {
+			answered++
+		}
+	}
+	if answered != 2 {
+		t.Log("Answered", answered, "packets instead of 2")
+		t.Fail()
+	}
+	if s.handle(queryRequest(queryTypeHandshake, 0, false), other, now) == nil {
+		t.Log("Rate limit applied to another address")
+		t.Fail()
+	}
+	if s.handle(queryRequest(queryTypeHandshake, 0, false), addr, now.Add(time.Second)) == nil {
+		t.Log("Rate limit did not refill")
+		t.Fail()
+	}
+}
@@ -0,0 +1,231 @@
+package typhoon
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	rconTypeResponseValue = 0
+	rconTypeExecCommand   = 2
+	rconTypeAuthResponse  = 2
+	rconTypeAuth          = 3
+
+	rconMaxRequestLength  = 1460
+	rconMaxResponseLength = 4096
+	rconAuthFailedId      = -1
+)
+
+var errRconPacketLength = errors.New("rcon: invalid packet length")
+
+type rconPacket struct {
+	RequestId int32
+	Type      int32
+	Body      string
+}
+
+func readRconPacket(rdr io.Reader) (packet rconPacket, err error) {
+	var length int32
+	if err = binary.Read(rdr, binary.LittleEndian, &length); err != nil {
+		return
+	}
+	if length < 10 || length > rconMaxRequestLength+10 {
+		err = errRconPacketLength
+		return
+	}
+	buff := make([]byte, length)
+	if _, err = io.ReadFull(rdr, buff); err != nil {
+		return
+	}
+	packet.RequestId = int32(binary.LittleEndian.Uint32(buff[0:4]))
+	packet.Type = int32(binary.LittleEndian.Uint32(buff[4:8]))
+	body := buff[8 : len(buff)-2]
+	if i := bytes.IndexByte(body, 0); i != -1 {
+		body = body[:i]
+	}
+	packet.Body = string(body)
+	return
+}
+
+func writeRconPacket(wtr io.Writer, packet rconPacket) error {
+	buff := make([]byte, 4+4+4+len(packet.Body)+2)
+	binary.LittleEndian.PutUint32(buff[0:4], uint32(len(buff)-4))
+	binary.LittleEndian.PutUint32(buff[4:8], uint32(packet.RequestId))
+	binary.LittleEndian.PutUint32(buff[8:12], uint32(packet.Type))
+	copy(buff[12:], packet.Body)
+	_, err := wtr.Write(buff)
+	return err
+}
+
+// rconSender collects the output of a command executed through RCON so it
+// can be sent back as the response body.
+type rconSender struct {
+	address string
+	output  *bytes.Buffer
+}
+
+func (sender *rconSender) GetName() string {
+	return "Rcon"
+}
+
+func (sender *rconSender) HasPermission(permission string) bool {
+	return true
+}
+
+func (sender *rconSender) SendMessage(message IChatComponent) {
+	if sender.output.Len() > 0 {
+		sender.output.WriteByte('\n')
+	}
+	sender.output.WriteString(ChatPlainText(message))
+}
+
+type rconServer struct {
+	core      *Core
+	listener  net.Listener
+	conns     map[net.Conn]bool
+	connMutex *sync.Mutex
+	connWait  *sync.WaitGroup
+}
+
+func newRconServer(core *Core) *rconServer {
+	return &rconServer{
+		core:      core,
+		listener:  nil,
+		conns:     make(map[net.Conn]bool),
+		connMutex: &sync.Mutex{},
+		connWait:  &sync.WaitGroup{},
+	}
+}
+
+func (c *Core) startRcon() error {
+	ln, err := net.Listen("tcp", c.getConfig().Rcon.ListenAddress)
+	if err != nil {
+		return err
+	}
+	rcon := newRconServer(c)
+	rcon.listener = ln
+	c.connMutex.Lock()
+	c.rcon = rcon
+	c.connMutex.Unlock()
+	c.Log(LevelInfo, "RCON listening", LogFields{"address": ln.Addr().String()})
+	go rcon.serve()
+	return nil
+}
+
+func (s *rconServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.core.isClosing() {
+				return
+			}
+			s.core.Log(LevelWarn, "RCON accept error", LogFields{"error": err})
+			continue
+		}
+		s.connMutex.Lock()
+		s.conns[conn] = true
+		s.connMutex.Unlock()
+		s.connWait.Add(1)
+		go s.handleConnection(conn)
+	}
+}
+
+func (s *rconServer) close() {
+	s.listener.Close()
+	s.connMutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connMutex.Unlock()
+	s.connWait.Wait()
+}
+
+func (s *rconServer) handleConnection(conn net.Conn) {
+	defer s.connWait.Done()
+	defer func() {
+		conn.Close()
+		s.connMutex.Lock()
+		delete(s.conns, conn)
+		s.connMutex.Unlock()
+	}()
+
+	address := conn.RemoteAddr().String()
+	rdr := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		packet, err := readRconPacket(rdr)
+		if err != nil {
+			if err != io.EOF {
+				s.core.Log(LevelWarn, "RCON protocol error", LogFields{"address": address, "error": err})
+			}
+			return
+		}
+
+		switch packet.Type {
+		case rconTypeAuth:
+			password := s.core.getConfig().Rcon.Password
+			if subtle.ConstantTimeCompare([]byte(packet.Body), []byte(password)) != 1 {
+				s.core.Log(LevelWarn, "RCON authentication failed", LogFields{"address": address})
+				writeRconPacket(conn, rconPacket{rconAuthFailedId, rconTypeAuthResponse, ""})
+				return
+			}
+			authenticated = true
+			if err := writeRconPacket(conn, rconPacket{packet.RequestId, rconTypeAuthResponse, ""}); err != nil {
+				return
+			}
+		case rconTypeExecCommand:
+			if !authenticated {
+				writeRconPacket(conn, rconPacket{rconAuthFailedId, rconTypeAuthResponse, ""})
+				return
+			}
+			s.core.Log(LevelInfo, "RCON issued server command", LogFields{"address": address, "command": packet.Body})
+			sender := &rconSender{address, &bytes.Buffer{}}
+			s.core.DispatchCommand(sender, packet.Body)
+			if err := s.respond(conn, packet.RequestId, sender.output.String()); err != nil {
+				return
+			}
+		case rconTypeResponseValue:
+			// Clients send an empty response packet after a command to
+			// detect the end of a split response, echo it back.
+			if err := writeRconPacket(conn, rconPacket{packet.RequestId, rconTypeResponseValue, ""}); err != nil {
+				return
+			}
+		default:
+			if err := s.respond(conn, packet.RequestId, fmt.Sprintf("Unknown request %x", packet.Type)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *rconServer) respond(conn net.Conn, id int32, body string) error {
+	for {
+		chunk := body
+		if len(chunk) > rconMaxResponseLength {
+			// Split before the rune cut by the limit, if any.
+			end := rconMaxResponseLength
+			for end > 0 && !utf8.RuneStart(body[end]) {
+				end--
+			}
+			if end == 0 {
+				end = rconMaxResponseLength
+			}
+			chunk = chunk[:end]
+		}
+		if err := writeRconPacket(conn, rconPacket{id, rconTypeResponseValue, chunk}); err != nil {
+			return err
+		}
+		body = body[len(chunk):]
+		if len(body) == 0 {
+			return nil
+		}
+	}
+}
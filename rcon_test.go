@@ -0,0 +1,123 @@
+package typhoon
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRconSession(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Rcon.Enabled = true
+	config.Rcon.Password = "secret"
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeclareCommand(CommandNodeLiteral("echo", []*CommandNode{
+		CommandNodeArgument("text", nil, &CommandParserString{CommandParserStringFormatGreedyPhrase},
+			func(ctx *CommandContext) {
+				ctx.GetSender().SendMessage(ChatMessage(ctx.GetString("text")))
+			}),
+	}, nil))
+
+	server, client := net.Pipe()
+	defer client.Close()
+	rcon := newRconServer(c)
+	rcon.connWait.Add(1)
+	go rcon.handleConnection(server)
+
+	exchange := func(request rconPacket) rconPacket {
+		if err := writeRconPacket(client, request); err != nil {
+			t.Fatal(err)
+		}
+		response, err := readRconPacket(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := exchange(rconPacket{7, rconTypeAuth, "secret"})
+	if response.RequestId != 7 || response.Type != rconTypeAuthResponse {
+		t.Log("Authentication rejected:", response)
+		t.Fail()
+	}
+
+	response = exchange(rconPacket{8, rconTypeExecCommand, "echo hello world"})
+	if response.RequestId != 8 || response.Body != "hello world" {
+		t.Log("Unexpected command response:", response)
+		t.Fail()
+	}
+
+	response = exchange(rconPacket{9, rconTypeExecCommand, "missing"})
+	if response.RequestId != 9 || response.Body != commandUnknownCommand+"\nmissing<--[HERE]" {
+		t.Log("Unexpected unknown command response:", response)
+		t.Fail()
+	}
+}
+
+func TestRconBadPassword(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Rcon.Enabled = true
+	config.Rcon.Password = "secret"
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	rcon := newRconServer(c)
+	rcon.connWait.Add(1)
+	go rcon.handleConnection(server)
+
+	if err := writeRconPacket(client, rconPacket{1, rconTypeAuth, "wrong"}); err != nil {
+		t.Fatal(err)
+	}
+	response, err := readRconPacket(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RequestId != rconAuthFailedId {
+		t.Log("Wrong password accepted")
+		t.Fail()
+	}
+}
+
+func TestRconSplitResponse(t *testing.T) {
+	c := newCore(DefaultConfig(), "")
+	server, client := net.Pipe()
+	defer client.Close()
+	rcon := newRconServer(c)
+
+	body := "a" + strings.Repeat("é", rconMaxResponseLength)
+	go rcon.respond(server, 3, body)
+
+	received := ""
+	for len(received) < len(body) {
+		var length int32
+		if err := binary.Read(client, binary.LittleEndian, &length); err != nil {
+			t.Fatal(err)
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(client, packet); err != nil {
+			t.Fatal(err)
+		}
+		chunk := string(packet[8 : len(packet)-2])
+		if len(chunk) > rconMaxResponseLength || !utf8.ValidString(chunk) {
+			t.Logf("Response split inside a rune, packet of %d bytes", len(chunk))
+			t.Fail()
+		}
+		received += chunk
+	}
+	if received != body {
+		t.Log("Split response does not add up to the body")
+		t.Fail()
+	}
+}
@@ -0,0 +1,241 @@
+package typhoon
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TicksPerSecond = 20
+	TickDuration   = time.Second / TicksPerSecond
+
+	tickStatsWindow = 100
+)
+
+type Task struct {
+	id        int
+	fn        func()
+	async     bool
+	next      uint64
+	period    uint64
+	cancelled int32
+}
+
+func (task *Task) GetId() int {
+	return task.id
+}
+
+func (task *Task) IsAsync() bool {
+	return task.async
+}
+
+func (task *Task) IsRepeating() bool {
+	return task.period > 0
+}
+
+func (task *Task) Cancel() {
+	atomic.StoreInt32(&task.cancelled, 1)
+}
+
+func (task *Task) IsCancelled() bool {
+	return atomic.LoadInt32(&task.cancelled) == 1
+}
+
+func (task *Task) run(c *Core) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.Log(LevelError, "Task panicked", LogFields{"task": task.id, "error": r})
+		}
+	}()
+	task.fn()
+}
+
+type Scheduler struct {
+	core          *Core
+	currentTick   uint64
+	taskCounter   int
+	tasks         []*Task
+	tasksMutex    *sync.Mutex
+	tickStarts    [tickStatsWindow]time.Time
+	tickDurations [tickStatsWindow]time.Duration
+	tickSamples   int
+	statsMutex    *sync.RWMutex
+}
+
+func newScheduler(core *Core) *Scheduler {
+	return &Scheduler{
+		core:        core,
+		currentTick: 0,
+		taskCounter: 0,
+		tasks:       make([]*Task, 0),
+		tasksMutex:  &sync.Mutex{},
+		tickSamples: 0,
+		statsMutex:  &sync.RWMutex{},
+	}
+}
+
+func (s *Scheduler) schedule(fn func(), delay int, period int, async bool) *Task {
+	if delay < 1 {
+		delay = 1
+	}
+	if period < 0 {
+		period = 0
+	}
+
+	s.tasksMutex.Lock()
+	s.taskCounter++
+	task := &Task{
+		id:     s.taskCounter,
+		fn:     fn,
+		async:  async,
+		next:   s.currentTick + uint64(delay),
+		period: uint64(period),
+	}
+	s.tasks = append(s.tasks, task)
+	s.tasksMutex.Unlock()
+	return task
+}
+
+// RunLater runs fn on the tick goroutine once the given number of ticks
+// has elapsed.
+func (s *Scheduler) RunLater(fn func(), ticks int) *Task {
+	return s.schedule(fn, ticks, 0, false)
+}
+
+// RunRepeating runs fn on the tick goroutine every period ticks, starting
+// one period from now, until the returned task is cancelled. A period
+// under one tick runs it every tick.
+func (s *Scheduler) RunRepeating(fn func(), period int) *Task {
+	if period < 1 {
+		period = 1
+	}
+	return s.schedule(fn, period, period, false)
+}
+
+// RunAsync runs fn in its own goroutine on the next tick.
+func (s *Scheduler) RunAsync(fn func()) *Task {
+	return s.schedule(fn, 1, 0, true)
+}
+
+func (s *Scheduler) RunLaterAsync(fn func(), ticks int) *Task {
+	return s.schedule(fn, ticks, 0, true)
+}
+
+func (s *Scheduler) RunRepeatingAsync(fn func(), period int) *Task {
+	if period < 1 {
+		period = 1
+	}
+	return s.schedule(fn, period, period, true)
+}
+
+func (s *Scheduler) GetCurrentTick() uint64 {
+	s.tasksMutex.Lock()
+	tick := s.currentTick
+	s.tasksMutex.Unlock()
+	return tick
+}
+
+func (s *Scheduler) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(TickDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.tick()
+		}
+	}
+}
+
+func (s *Scheduler) tick() {
+	start := time.Now()
+
+	s.tasksMutex.Lock()
+	s.currentTick++
+	due := make([]*Task, 0)
+	pending := s.tasks[:0]
+	for _, task := range s.tasks {
+		if task.IsCancelled() {
+			continue
+		}
+		if task.next <= s.currentTick {
+			due = append(due, task)
+			if task.period == 0 {
+				continue
+			}
+			task.next = s.currentTick + task.period
+		}
+		pending = append(pending, task)
+	}
+	for i := len(pending); i < len(s.tasks); i++ {
+		s.tasks[i] = nil
+	}
+	s.tasks = pending
+	s.tasksMutex.Unlock()
+
+	for _, task := range due {
+		if task.IsCancelled() {
+			continue
+		}
+		if task.async {
+			go task.run(s.core)
+		} else {
+			task.run(s.core)
+		}
+	}
+
+	s.statsMutex.Lock()
+	i := s.tickSamples % tickStatsWindow
+	s.tickStarts[i] = start
+	s.tickDurations[i] = time.Since(start)
+	s.tickSamples++
+	s.statsMutex.Unlock()
+}
+
+// GetTPS returns the number of ticks per second measured over the last
+// 100 ticks, capped at TicksPerSecond.
+func (s *Scheduler) GetTPS() float64 {
+	s.statsMutex.RLock()
+	defer s.statsMutex.RUnlock()
+
+	samples := s.tickSamples
+	if samples > tickStatsWindow {
+		samples = tickStatsWindow
+	}
+	if samples < 2 {
+		return TicksPerSecond
+	}
+	last := s.tickStarts[(s.tickSamples-1)%tickStatsWindow]
+	first := s.tickStarts[(s.tickSamples-samples)%tickStatsWindow]
+	elapsed := last.Sub(first).Seconds()
+	if elapsed <= 0 {
+		return TicksPerSecond
+	}
+	tps := float64(samples-1) / elapsed
+	if tps > TicksPerSecond {
+		tps = TicksPerSecond
+	}
+	return tps
+}
+
+// GetMSPT returns the average time spent running a tick, in milliseconds,
+// over the last 100 ticks.
+func (s *Scheduler) GetMSPT() float64 {
+	s.statsMutex.RLock()
+	defer s.statsMutex.RUnlock()
+
+	samples := s.tickSamples
+	if samples > tickStatsWindow {
+		samples = tickStatsWindow
+	}
+	if samples == 0 {
+		return 0
+	}
+	var total time.Duration
+	for i := 0; i < samples; i++ {
+		total += s.tickDurations[i]
+	}
+	return float64(total) / float64(samples) / float64(time.Millisecond)
+}
@@ -0,0 +1,105 @@
+package typhoon
+
+import (
+	"testing"
+)
+
+func TestSchedulerRunLater(t *testing.T) {
+	s := newScheduler(nil)
+
+	runs := 0
+	s.RunLater(func() {
+		runs++
+	}, 3)
+
+	for i := 0; i < 2; i++ {
+		s.tick()
+	}
+	if runs != 0 {
+		t.Log("Task ran before its delay")
+		t.Fail()
+	}
+
+	for i := 0; i < 5; i++ {
+		s.tick()
+	}
+	if runs != 1 {
+		t.Log("Task ran", runs, "times instead of 1")
+		t.Fail()
+	}
+	if len(s.tasks) != 0 {
+		t.Log("Finished task is still scheduled")
+		t.Fail()
+	}
+}
+
+func TestSchedulerRunRepeating(t *testing.T) {
+	s := newScheduler(nil)
+
+	runs := 0
+	task := s.RunRepeating(func() {
+		runs++
+	}, 2)
+
+	for i := 0; i < 6; i++ {
+		s.tick()
+	}
+	if runs != 3 {
+		t.Log("Task ran", runs, "times instead of 3")
+		t.Fail()
+	}
+
+	task.Cancel()
+	for i := 0; i < 6; i++ {
+		s.tick()
+	}
+	if runs != 3 {
+		t.Log("Cancelled task kept running")
+		t.Fail()
+	}
+	if len(s.tasks) != 0 {
+		t.Log("Cancelled task is still scheduled")
+		t.Fail()
+	}
+}
+
+func TestSchedulerRunRepeatingZeroPeriod(t *testing.T) {
+	s := newScheduler(nil)
+
+	runs := 0
+	s.RunRepeating(func() {
+		runs++
+	}, 0)
+	for i := 0; i < 3; i++ {
+		s.tick()
+	}
+	if runs != 3 {
+		t.Log("Task with a zero period ran", runs, "times instead of 3")
+		t.Fail()
+	}
+}
+
+func TestSchedulerPanicRecovery(t *testing.T) {
+	logger := &recordLogger{}
+	c := newCore(DefaultConfig(), "")
+	c.logger = logger
+	s := c.scheduler
+
+	ran := false
+	s.RunLater(func() {
+		panic("boom")
+	}, 1)
+	s.RunLater(func() {
+		ran = true
+	}, 1)
+	s.tick()
+
+	if !ran {
+		t.Log("Panicking task prevented the next one from running")
+		t.Fail()
+	}
+	if len(logger.entries) != 1 || logger.entries[0].level != LevelError || logger.entries[0].fields["error"] != "boom" {
+		t.Log("Panic not logged", logger.entries)
+		t.Fail()
+	}
+}
@@ -0,0 +1,157 @@
+package typhoon
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type ThrottleReason string
+
+const (
+	ThrottleConnectionRate ThrottleReason = "connection_rate"
+	ThrottleConcurrent     ThrottleReason = "concurrent_connections"
+	ThrottleTimeout        ThrottleReason = "timeout"
+	ThrottlePacketRate     ThrottleReason = "packet_rate"
+)
+
+const throttleCleanupInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket at rate tokens per second up to burst, then
+// takes one token if available.
+func (bucket *tokenBucket) take(rate float64, burst float64, now time.Time) bool {
+	if bucket.last.IsZero() {
+		bucket.tokens = burst
+	} else {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+	}
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+type throttleClient struct {
+	bucket      tokenBucket
+	connections int
+}
+
+// connectionThrottle limits the connections accepted from each IP address.
+type connectionThrottle struct {
+	core        *Core
+	clients     map[string]*throttleClient
+	mutex       *sync.Mutex
+	lastCleanup time.Time
+}
+
+func newConnectionThrottle(core *Core) *connectionThrottle {
+	return &connectionThrottle{
+		core:        core,
+		clients:     make(map[string]*throttleClient),
+		mutex:       &sync.Mutex{},
+		lastCleanup: time.Now(),
+	}
+}
+
+func connectionHost(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// accept registers a new connection from host, or returns the reason why
+// it must be refused.
+func (t *connectionThrottle) accept(host string, now time.Time) ThrottleReason {
+	config := t.core.getConfig().Throttle
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.cleanup(now)
+	client, ok := t.clients[host]
+	if !ok {
+		client = &throttleClient{}
+		t.clients[host] = client
+	}
+	if config.MaxConnectionsPerIp > 0 && client.connections >= config.MaxConnectionsPerIp {
+		return ThrottleConcurrent
+	}
+	if config.ConnectionsPerMinute > 0 &&
+		!client.bucket.take(float64(config.ConnectionsPerMinute)/60, float64(config.ConnectionBurst), now) {
+		return ThrottleConnectionRate
+	}
+	client.connections++
+	return ""
+}
+
+func (t *connectionThrottle) release(host string) {
+	t.mutex.Lock()
+	if client, ok := t.clients[host]; ok {
+		client.connections--
+	}
+	t.mutex.Unlock()
+}
+
+func (t *connectionThrottle) cleanup(now time.Time) {
+	if now.Sub(t.lastCleanup) < throttleCleanupInterval {
+		return
+	}
+	t.lastCleanup = now
+	for host, client := range t.clients {
+		if client.connections == 0 && now.Sub(client.bucket.last) > throttleCleanupInterval {
+			delete(t.clients, host)
+		}
+	}
+}
+
+// throttled fires a ConnectionThrottledEvent and counts it in the metrics.
+// player is nil when the connection was refused before being handled.
+func (c *Core) throttled(addr net.Addr, player *Player, reason ThrottleReason) {
+	c.metrics.connectionThrottled(reason)
+	fields := LogFields{"address": addr.String(), "reason": string(reason)}
+	if player != nil {
+		player.Log(LevelWarn, "Connection throttled", fields)
+	} else {
+		c.Log(LevelWarn, "Connection throttled", fields)
+	}
+	c.CallEvent(&ConnectionThrottledEvent{addr, player, reason})
+}
+
+// allowPacket applies Throttle.PacketsPerSecond to the packets a player
+// sends in PLAY.
+func (player *Player) allowPacket(now time.Time) bool {
+	rate := player.core.getConfig().Throttle.PacketsPerSecond
+	if rate <= 0 || player.getState() != PLAY {
+		return true
+	}
+	return player.packetBucket.take(float64(rate), float64(rate), now)
+}
+
+// connectionDeadline returns when the connection must have completed the
+// handshake, or the login when already past it.
+func (player *Player) connectionDeadline() time.Time {
+	config := player.core.getConfig().Throttle
+	timeout := config.LoginTimeout
+	if player.getState() == HANDSHAKING {
+		timeout = config.HandshakeTimeout
+	}
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return player.connected.Add(time.Duration(timeout) * time.Second)
+}
@@ -0,0 +1,76 @@
+package typhoon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionThrottle(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Throttle.ConnectionsPerMinute = 60
+	config.Throttle.ConnectionBurst = 3
+	config.Throttle.MaxConnectionsPerIp = 2
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle := newConnectionThrottle(c)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if reason := throttle.accept("10.0.0.1", now); reason != "" {
+			t.Fatal("Connection", i, "refused:", reason)
+		}
+	}
+	if reason := throttle.accept("10.0.0.1", now); reason != ThrottleConcurrent {
+		t.Log("Expected a concurrent connections limit, got", reason)
+		t.Fail()
+	}
+	if reason := throttle.accept("10.0.0.2", now); reason != "" {
+		t.Log("Other address refused:", reason)
+		t.Fail()
+	}
+
+	throttle.release("10.0.0.1")
+	if reason := throttle.accept("10.0.0.1", now); reason != "" {
+		t.Log("Released connection refused:", reason)
+		t.Fail()
+	}
+	throttle.release("10.0.0.1")
+	throttle.release("10.0.0.1")
+	if reason := throttle.accept("10.0.0.1", now); reason != ThrottleConnectionRate {
+		t.Log("Expected a connection rate limit, got", reason)
+		t.Fail()
+	}
+	if reason := throttle.accept("10.0.0.1", now.Add(time.Second)); reason != "" {
+		t.Log("Refilled bucket refused:", reason)
+		t.Fail()
+	}
+}
+
+func TestPacketThrottle(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.Throttle.PacketsPerSecond = 10
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := &Player{core: c, state: int32(PLAY)}
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		if !player.allowPacket(now) {
+			t.Fatal("Packet", i, "refused")
+		}
+	}
+	if player.allowPacket(now) {
+		t.Log("Packet over the limit allowed")
+		t.Fail()
+	}
+	if !player.allowPacket(now.Add(100 * time.Millisecond)) {
+		t.Log("Refilled bucket refused")
+		t.Fail()
+	}
+}
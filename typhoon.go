@@ -2,61 +2,450 @@ package typhoon
 
 import (
 	"bufio"
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 type Core struct {
-	connCounter      int
-	eventHandlers    map[reflect.Type][]EventCallback
-	brand            string
-	rootCommand      CommandNode
-	compiledCommands []commandNode
-	playerRegistry   *PlayerRegistry
+	connCounter         int
+	eventHandlers       map[reflect.Type][]EventCallback
+	brand               string
+	rootCommand         CommandNode
+	commandMutex        *sync.RWMutex
+	cooldowns           *commandCooldowns
+	playerRegistry      *PlayerRegistry
+	scheduler           *Scheduler
+	config              atomic.Value
+	configPath          string
+	configModTime       time.Time
+	configMutex         *sync.Mutex
+	customFavicon       string
+	virtualHostHandlers *virtualHostHandlers
+	rcon                *rconServer
+	query               *queryServer
+	metrics             *Metrics
+	metricsServer       *http.Server
+	logger              Logger
+	throttle            *connectionThrottle
+	bannedPlayers       *BanList
+	bannedIps           *BanList
+	whitelist           *Whitelist
+	permissionProvider  PermissionProvider
+	console             *ConsoleSender
+	terminal            *Console
+	signals             bool
+	packets             map[int64]reflect.Type
+	clientbound         map[Protocol]map[int]int
+	serverbound         map[Protocol]map[int]int
+	protocols           []Protocol
+	versionNames        map[Protocol]string
+	joinGame            PacketPlayJoinGame
+	positionLook        PacketPlayerPositionLook
+	listener            net.Listener
+	connections         map[int]*Player
+	connMutex           *sync.Mutex
+	connWait            *sync.WaitGroup
+	closing             int32
+	closed              chan struct{}
 }
 
+var ErrServerClosed = errors.New("typhoon: server closed")
+
+// Option customizes a Core while it is being initialized.
+type Option func(c *Core) error
+
+func WithBrand(brand string) Option {
+	return func(c *Core) error {
+		c.SetBrand(brand)
+		return nil
+	}
+}
+
+// WithSignals stops the server on SIGINT and SIGTERM and reloads its
+// configuration on SIGHUP. Signals are received by the whole process, so
+// only one core should handle them.
+func WithSignals() Option {
+	return func(c *Core) error {
+		c.signals = true
+		return nil
+	}
+}
+
+// WithFavicon replaces the server list icon with the given 64x64 PNG image.
+func WithFavicon(png []byte) Option {
+	return func(c *Core) error {
+		c.customFavicon = encodeFavicon(png)
+		return nil
+	}
+}
+
+// Init creates a core from the file returned by ConfigPath. The default
+// configuration is used when ./config.json does not exist; any other error
+// panics.
 func Init() *Core {
-	initConfig()
-	initPackets()
-	initHacks()
+	path := ConfigPath()
+	c, err := InitFromFile(path)
+	if os.IsNotExist(err) && path == defaultConfigPath {
+		c, err = InitWithConfig(DefaultConfig())
+	}
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func InitFromFile(path string, options ...Option) (*Core, error) {
+	config, raw, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := initCore(config, raw, options)
+	if err != nil {
+		return nil, err
+	}
+	c.configPath = path
+	if info, err := os.Stat(path); err == nil {
+		c.configModTime = info.ModTime()
+	}
+	return c, nil
+}
+
+func InitWithConfig(config Config, options ...Option) (*Core, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	return initCore(config, raw, options)
+}
+
+func initCore(config Config, raw []byte, options []Option) (*Core, error) {
+	favicon, err := loadFavicon(config.Favicon)
+	if err != nil {
+		return nil, err
+	}
+	hostFavicons, err := loadVirtualHostFavicons(config.VirtualHosts)
+	if err != nil {
+		return nil, err
+	}
+	c := newCore(config, favicon)
+	c.config.Store(&loadedConfig{config, raw, favicon, hostFavicons})
+	if err := c.loadAccessLists(config.Access); err != nil {
+		return nil, err
+	}
+	if err := c.loadPermissions(config.Permissions); err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func newCore(config Config, favicon string) *Core {
+	protocols := make([]Protocol, len(COMPATIBLE_PROTO))
+	copy(protocols, COMPATIBLE_PROTO)
+	names := make(map[Protocol]string, len(versionNames))
+	for proto, name := range versionNames {
+		names[proto] = name
+	}
+
 	c := &Core{
-		0,
-		make(map[reflect.Type][]EventCallback),
-		"typhoon",
-		CommandNode{
+		connCounter:   0,
+		eventHandlers: make(map[reflect.Type][]EventCallback),
+		brand:         "typhoon",
+		rootCommand: CommandNode{
 			commandNodeTypeRoot,
 			nil,
 			nil,
 			nil,
+			nil,
 			"",
 			nil,
+			"",
+			nil,
+			nil,
+			nil,
+		},
+		commandMutex:        &sync.RWMutex{},
+		cooldowns:           newCommandCooldowns(),
+		playerRegistry:      newPlayerRegistry(),
+		configMutex:         &sync.Mutex{},
+		virtualHostHandlers: newVirtualHostHandlers(),
+		console:             newConsoleSender(os.Stdout),
+		logger:              stdLogger{},
+		packets:             make(map[int64]reflect.Type),
+		clientbound:         make(map[Protocol]map[int]int),
+		serverbound:         make(map[Protocol]map[int]int),
+		protocols:           protocols,
+		versionNames:        names,
+		joinGame: PacketPlayJoinGame{
+			EntityId:            0,
+			Gamemode:            SPECTATOR,
+			Dimension:           END,
+			HashedSeed:          0,
+			Difficulty:          NORMAL,
+			LevelType:           DEFAULT,
+			MaxPlayers:          0xFF,
+			ReducedDebug:        false,
+			EnableRespawnScreen: true,
 		},
-		nil,
-		newPlayerRegistry(),
+		positionLook: PacketPlayerPositionLook{},
+		connections:  make(map[int]*Player),
+		connMutex:    &sync.Mutex{},
+		connWait:     &sync.WaitGroup{},
+		closing:      0,
+		closed:       make(chan struct{}),
 	}
-	c.compileCommands()
+	c.metrics = newMetrics(c)
+	c.throttle = newConnectionThrottle(c)
+	c.scheduler = newScheduler(c)
+	c.config.Store(&loadedConfig{config, nil, favicon, nil})
+	if err := c.loadAccessLists(AccessConfig{}); err != nil {
+		c.Log(LevelError, "Can't create the access lists", LogFields{"error": err})
+	}
+	c.initPackets()
+	c.initHacks()
 	return c
 }
 
-func (c *Core) Start() {
-	ln, err := net.Listen("tcp", config.ListenAddress)
+// Start listens on the configured address and serves connections until
+// the context is cancelled, Shutdown is called or, with WithSignals,
+// SIGINT/SIGTERM is received. It returns nil once the shutdown has
+// completed.
+func (c *Core) Start(ctx context.Context) error {
+	if c.isClosing() {
+		return ErrServerClosed
+	}
+	ln, err := net.Listen("tcp", c.getConfig().ListenAddress)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	c.connMutex.Lock()
+	c.listener = ln
+	c.connMutex.Unlock()
+	c.Log(LevelInfo, "Server launched", LogFields{"address": ln.Addr().String()})
+
+	if c.getConfig().Rcon.Enabled {
+		if err := c.startRcon(); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	if c.getConfig().Query.Enabled {
+		if err := c.startQuery(); err != nil {
+			ln.Close()
+			if c.rcon != nil {
+				c.rcon.close()
+			}
+			return err
+		}
+	}
+	if c.getConfig().Metrics.Enabled {
+		if err := c.startMetrics(); err != nil {
+			ln.Close()
+			if c.rcon != nil {
+				c.rcon.close()
+			}
+			if c.query != nil {
+				c.query.close()
+			}
+			return err
+		}
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	c.scheduler.RunRepeating(func() {
+		c.keepAlive(r, time.Now())
+	}, TicksPerSecond)
+	c.scheduler.RunRepeating(c.updateLatency, latencyUpdatePeriod)
+	if c.configPath != "" {
+		c.scheduler.RunRepeatingAsync(c.watchConfig, 2*TicksPerSecond)
+	}
+	go c.scheduler.run(c.closed)
+
+	go c.waitShutdown(ctx)
+
+	if c.terminal != nil {
+		c.terminal.start()
 	}
-	log.Println("Server launched on port", config.ListenAddress)
-	go c.keepAlive()
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			log.Print(err)
+			if c.isClosing() {
+				<-c.closed
+				return nil
+			}
+			c.Log(LevelWarn, "Accept error", LogFields{"error": err})
+			continue
+		}
+		c.metrics.connectionAccepted()
+		if reason := c.throttle.accept(connectionHost(conn.RemoteAddr()), time.Now()); reason != "" {
+			conn.Close()
+			c.throttled(conn.RemoteAddr(), nil, reason)
+			continue
+		}
+		c.connCounter += 1
+		player := c.newPlayer(conn, c.connCounter)
+		if !c.addConnection(player) {
+			conn.Close()
+			c.throttle.release(connectionHost(conn.RemoteAddr()))
+			continue
+		}
+		go c.handleConnection(player)
+	}
+}
+
+// addConnection registers a connection for Shutdown to close, unless the
+// server is already shutting down.
+func (c *Core) addConnection(player *Player) bool {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	if c.isClosing() {
+		return false
+	}
+	c.connections[player.id] = player
+	c.connWait.Add(1)
+	return true
+}
+
+// signalShutdownTimeout bounds the time given to the players to disconnect
+// when the server is stopped by a signal.
+const signalShutdownTimeout = 10 * time.Second
+
+// waitShutdown shuts the server down when the context is cancelled, or on
+// the signals handled with WithSignals.
+func (c *Core) waitShutdown(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	if c.signals {
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(signals)
+	}
+
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				c.Log(LevelInfo, "Received SIGHUP, reloading configuration", nil)
+				if err := c.ReloadConfig(); err != nil {
+					c.Log(LevelError, "Can't reload config", LogFields{"error": err})
+				}
+				continue
+			}
+			c.Log(LevelInfo, "Received signal, shutting down", LogFields{"signal": sig})
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-c.closed:
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), signalShutdownTimeout)
+	defer cancel()
+	if err := c.Shutdown(ctx, ""); err != nil && err != ErrServerClosed {
+		c.Log(LevelError, "Shutdown failed", LogFields{"error": err})
+	}
+}
+
+func (c *Core) isClosing() bool {
+	return atomic.LoadInt32(&c.closing) == 1
+}
+
+// Shutdown stops accepting connections, kicks every connected player with
+// the given reason (or the configured shutdown message when empty) and
+// waits for their connections to close. If the context expires first, the
+// remaining connections are closed forcefully and the context error is
+// returned. A ServerStopEvent is fired once every connection goroutine has
+// exited.
+func (c *Core) Shutdown(ctx context.Context, reason string) error {
+	if !atomic.CompareAndSwapInt32(&c.closing, 0, 1) {
+		select {
+		case <-c.closed:
+			return ErrServerClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer close(c.closed)
+
+	if reason == "" {
+		reason = c.getConfig().ShutdownMessage
+	}
+	c.Log(LevelInfo, "Stopping server", LogFields{"reason": reason})
+
+	c.connMutex.Lock()
+	rcon := c.rcon
+	query := c.query
+	metricsServer := c.metricsServer
+	if c.listener != nil {
+		c.listener.Close()
+	}
+	players := make([]*Player, 0, len(c.connections))
+	for _, player := range c.connections {
+		players = append(players, player)
+	}
+	c.connMutex.Unlock()
+
+	if rcon != nil {
+		rcon.close()
+	}
+	if query != nil {
+		query.close()
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+
+	for _, player := range players {
+		if state := player.getState(); state == PLAY || state == LOGIN {
+			player.kick(kickShutdown, reason)
 		} else {
-			c.connCounter += 1
-			go c.handleConnection(conn, c.connCounter)
+			player.conn.Close()
 		}
 	}
+
+	done := make(chan struct{})
+	go func() {
+		c.connWait.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		c.connMutex.Lock()
+		for _, player := range c.connections {
+			player.conn.Close()
+		}
+		c.connMutex.Unlock()
+		<-done
+	}
+
+	c.CallEvent(&ServerStopEvent{reason})
+	c.Log(LevelInfo, "Server stopped", nil)
+	if c.terminal != nil {
+		c.terminal.stop()
+	}
+	return err
 }
 
 func (c *Core) SetBrand(brand string) {
@@ -69,36 +458,16 @@ func (c *Core) GetPlayerRegistry() *PlayerRegistry {
 	return c.playerRegistry
 }
 
-func (c *Core) keepAlive() {
-	r := rand.New(rand.NewSource(15768735131534))
-	keepalive := &PacketPlayKeepAlive{
-		Identifier: 0,
-	}
-	for {
-		c.playerRegistry.ForEachPlayer(func(player *Player) {
-			if player.state == PLAY {
-				if player.keepalive != 0 {
-					player.Kick("Timed out")
-				}
-
-				id := int(r.Int31())
-				keepalive.Identifier = id
-				player.keepalive = id
-				player.WritePacket(keepalive)
-			}
-		})
-		time.Sleep(5000000000)
-	}
+func (c *Core) GetScheduler() *Scheduler {
+	return c.scheduler
 }
 
-func (c *Core) handleConnection(conn net.Conn, id int) {
-	log.Printf("%s(#%d) connected.", conn.RemoteAddr().String(), id)
-
-	player := &Player{
+func (c *Core) newPlayer(conn net.Conn, id int) *Player {
+	return &Player{
 		core:     c,
 		id:       id,
 		conn:     conn,
-		state:    HANDSHAKING,
+		state:    int32(HANDSHAKING),
 		protocol: V1_10,
 		io: &ConnReadWrite{
 			rdr: bufio.NewReader(conn),
@@ -108,23 +477,50 @@ func (c *Core) handleConnection(conn net.Conn, id int) {
 			"",
 			0,
 		},
-		name:        "",
-		uuid:        "d979912c-bb24-4f23-a6ac-c32985a1e5d3",
-		keepalive:   0,
-		compression: false,
+		name:             "",
+		uuid:             "d979912c-bb24-4f23-a6ac-c32985a1e5d3",
+		keepalive:        0,
+		keepaliveSent:    0,
+		ping:             0,
+		compression:      false,
+		connected:        time.Now(),
+		permissions:      make(PermissionSet),
+		permissionsMutex: &sync.RWMutex{},
+		writeMutex:       &sync.Mutex{},
 	}
+}
+
+func (c *Core) handleConnection(player *Player) {
+	defer c.connWait.Done()
+	conn := player.conn
+
+	player.Log(LevelInfo, "Connected", LogFields{"address": conn.RemoteAddr().String()})
 
 	for {
+		player.updateReadDeadline()
 		_, err := player.ReadPacket()
 		if err != nil {
+			if err, ok := err.(net.Error); ok && err.Timeout() && player.getState() != PLAY {
+				c.throttled(conn.RemoteAddr(), player, ThrottleTimeout)
+			}
+			break
+		}
+		if !player.allowPacket(time.Now()) {
+			c.throttled(conn.RemoteAddr(), player, ThrottlePacketRate)
+			player.kick(kickPacketRate, "Too many packets")
 			break
 		}
 	}
 
-	if player.state == PLAY {
+	if player.getState() == PLAY {
 		player.core.CallEvent(&PlayerQuitEvent{player})
 		player.unregister()
 	}
 	conn.Close()
-	log.Printf("%s(#%d) disconnected.", conn.RemoteAddr().String(), id)
+	c.throttle.release(connectionHost(conn.RemoteAddr()))
+
+	c.connMutex.Lock()
+	delete(c.connections, player.id)
+	c.connMutex.Unlock()
+	player.Log(LevelInfo, "Disconnected", LogFields{"address": conn.RemoteAddr().String()})
 }
@@ -0,0 +1,157 @@
+package typhoon
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoreIndependentState(t *testing.T) {
+	a := newCore(Config{MaxPlayers: 10}, "")
+	b := newCore(Config{MaxPlayers: 20}, "")
+
+	a.registerProtocol(Protocol(9999), "test")
+	if !a.IsCompatible(Protocol(9999)) || a.versionName() != "test" {
+		t.Log("Registered protocol is not compatible")
+		t.Fail()
+	}
+	if b.IsCompatible(Protocol(9999)) || IsCompatible(Protocol(9999)) || b.versionName() != "1.15.1" {
+		t.Log("Protocol registration leaked to another core")
+		t.Fail()
+	}
+
+	a.clientbound[V1_8][0x00] = 0x42
+	if b.clientbound[V1_8][0x00] == 0x42 {
+		t.Log("Protocol maps are shared between cores")
+		t.Fail()
+	}
+
+	if a.getConfig().MaxPlayers == b.getConfig().MaxPlayers {
+		t.Log("Config is shared between cores")
+		t.Fail()
+	}
+}
+
+// startTestServer starts a core on a random port with one client
+// connected, returning the client and the result of Start.
+func startTestServer(t *testing.T, c *Core) (net.Conn, chan error) {
+	result := make(chan error, 1)
+	go func() {
+		result <- c.Start(context.Background())
+	}()
+	var addr net.Addr
+	for deadline := time.Now().Add(5 * time.Second); addr == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		c.connMutex.Lock()
+		if c.listener != nil {
+			addr = c.listener.Addr()
+		}
+		c.connMutex.Unlock()
+	}
+	if addr == nil {
+		t.Fatal("Server not listening")
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		c.connMutex.Lock()
+		connected := len(c.connections) == 1
+		c.connMutex.Unlock()
+		if connected {
+			break
+		}
+	}
+	return conn, result
+}
+
+func TestStartShutdown(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.ListenAddress = "127.0.0.1:0"
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := false
+	c.On(func(e *ServerStopEvent) {
+		stopped = true
+	})
+
+	conn, result := startTestServer(t, c)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Log("Start failed:", err)
+		t.Fail()
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Log("Connection not closed:", err)
+		t.Fail()
+	}
+	if !stopped {
+		t.Log("ServerStopEvent not fired")
+		t.Fail()
+	}
+
+	if c.addConnection(c.newPlayer(conn, 42)) {
+		t.Log("Connection registered after shutdown")
+		t.Fail()
+	}
+	if err := c.Start(context.Background()); err != ErrServerClosed {
+		t.Log("Server restarted:", err)
+		t.Fail()
+	}
+}
+
+// slowDisconnectLogger holds connection goroutines on their last log.
+type slowDisconnectLogger struct {
+	disconnected int32
+}
+
+func (l *slowDisconnectLogger) Log(level LogLevel, message string, fields LogFields) {
+	if message == "Disconnected" {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&l.disconnected, 1)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.ListenAddress = "127.0.0.1:0"
+	logger := &slowDisconnectLogger{}
+	c, err := InitWithConfig(config, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exited := false
+	c.On(func(e *ServerStopEvent) {
+		exited = atomic.LoadInt32(&logger.disconnected) == 1
+	})
+
+	conn, result := startTestServer(t, c)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Shutdown(ctx, ""); err != context.Canceled {
+		t.Log("Shutdown did not time out:", err)
+		t.Fail()
+	}
+	<-result
+	if !exited {
+		t.Log("ServerStopEvent fired before the connections exited")
+		t.Fail()
+	}
+}
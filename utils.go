@@ -40,10 +40,16 @@ func (player *Player) ReadVarInt() (i int, err error) {
 	return int(v), nil
 }
 
+// varIntSize returns the number of bytes of i encoded as a VarInt.
+func varIntSize(i int) int {
+	var buff [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buff[:], uint64(i))
+}
+
 func (player *Player) WriteVarInt(i int) (err error) {
-	buff := player.io.buffer[:]
+	buff := player.out.buffer[:]
 	length := binary.PutUvarint(buff, uint64(i))
-	_, err = player.io.wtr.Write(buff[:length])
+	_, err = player.out.wtr.Write(buff[:length])
 	return err
 }
 
@@ -57,13 +63,13 @@ func (player *Player) ReadBool() (b bool, err error) {
 }
 
 func (player *Player) WriteBool(b bool) (err error) {
-	buff := player.io.buffer[:1]
+	buff := player.out.buffer[:1]
 	if b {
 		buff[0] = 0x01
 	} else {
 		buff[0] = 0x00
 	}
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -80,9 +86,9 @@ func (player *Player) ReadUInt8() (i uint8, err error) {
 }
 
 func (player *Player) WriteUInt8(i uint8) (err error) {
-	buff := player.io.buffer[:1]
+	buff := player.out.buffer[:1]
 	buff[0] = i
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -99,9 +105,9 @@ func (player *Player) ReadUInt16() (i uint16, err error) {
 }
 
 func (player *Player) WriteUInt16(i uint16) (err error) {
-	buff := player.io.buffer[:2]
+	buff := player.out.buffer[:2]
 	binary.BigEndian.PutUint16(buff, i)
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -118,9 +124,9 @@ func (player *Player) ReadUInt32() (i uint32, err error) {
 }
 
 func (player *Player) WriteUInt32(i uint32) (err error) {
-	buff := player.io.buffer[:4]
+	buff := player.out.buffer[:4]
 	binary.BigEndian.PutUint32(buff, i)
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -137,9 +143,9 @@ func (player *Player) ReadUInt64() (i uint64, err error) {
 }
 
 func (player *Player) WriteUInt64(i uint64) (err error) {
-	buff := player.io.buffer[:8]
+	buff := player.out.buffer[:8]
 	binary.BigEndian.PutUint64(buff, i)
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -177,9 +183,9 @@ func (player *Player) ReadFloat32() (i float32, err error) {
 }
 
 func (player *Player) WriteFloat32(i float32) (err error) {
-	buff := player.io.buffer[:4]
+	buff := player.out.buffer[:4]
 	binary.BigEndian.PutUint32(buff, math.Float32bits(i))
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -196,9 +202,9 @@ func (player *Player) ReadFloat64() (i float64, err error) {
 }
 
 func (player *Player) WriteFloat64(i float64) (err error) {
-	buff := player.io.buffer[:8]
+	buff := player.out.buffer[:8]
 	binary.BigEndian.PutUint64(buff, math.Float64bits(i))
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	if err != nil {
 		return err
 	}
@@ -259,7 +265,7 @@ func (player *Player) ReadNStringLimited(max int) (s string, read int, err error
 }
 
 func (player *Player) WriteByteArray(data []byte) (err error) {
-	_, err = player.io.wtr.Write(data)
+	_, err = player.out.wtr.Write(data)
 	return err
 }
 
@@ -275,7 +281,7 @@ func (player *Player) WriteString(s string) (err error) {
 	if err != nil {
 		return err
 	}
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	return err
 }
 
@@ -288,23 +294,43 @@ func (player *Player) WriteStringRestricted(s string, max int) (err error) {
 	if err != nil {
 		return err
 	}
-	_, err = player.io.wtr.Write(buff)
+	_, err = player.out.wtr.Write(buff)
 	return err
 }
 
 func (player *Player) WriteUUID(uid uuid.UUID) (err error) {
-	_, err = player.io.wtr.Write(uid[:])
+	_, err = player.out.wtr.Write(uid[:])
 	return err
 }
 
+// kickCategory groups the kicks in the metrics, whatever their message.
+type kickCategory string
+
+const (
+	kickTimeout        kickCategory = "timeout"
+	kickBanned         kickCategory = "banned"
+	kickNotWhitelisted kickCategory = "not_whitelisted"
+	kickDuplicateLogin kickCategory = "duplicate_login"
+	kickPacketRate     kickCategory = "packet_rate"
+	kickThrottled      kickCategory = "throttled"
+	kickShutdown       kickCategory = "shutdown"
+	kickOther          kickCategory = "other"
+)
+
 func (player *Player) Kick(s string) {
-	if player.state == LOGIN {
-		player.loginKick(s)
+	player.kick(kickOther, s)
+}
+
+func (player *Player) kick(category kickCategory, s string) {
+	if player.getState() == LOGIN {
+		player.loginKick(category, s)
 		return
 	}
 
 	player.core.CallEvent(&PlayerKickEvent{player, s})
-	msg := fmt.Sprintf(`{"text": "%s"}`, s)
+	player.core.metrics.playerKicked(category)
+	player.Log(LevelWarn, "Kicked", LogFields{"reason": s})
+	msg := fmt.Sprintf(`{"text": "%s"}`, JsonEscape(s))
 	disconnect := PacketPlayDisconnect{
 		Component: msg,
 	}
@@ -312,8 +338,10 @@ func (player *Player) Kick(s string) {
 	player.conn.Close()
 }
 
-func (player *Player) loginKick(s string) {
-	msg := fmt.Sprintf(`{"text": "%s"}`, s)
+func (player *Player) loginKick(category kickCategory, s string) {
+	player.core.metrics.playerKicked(category)
+	player.Log(LevelWarn, "Kicked", LogFields{"reason": s})
+	msg := fmt.Sprintf(`{"text": "%s"}`, JsonEscape(s))
 	disconnect := PacketLoginDisconnect{
 		Component: msg,
 	}
@@ -323,6 +351,7 @@ func (player *Player) loginKick(s string) {
 
 func JsonEscape(s string) string {
 	str := strings.Replace(s, `\`, `\\`, -1)
+	str = strings.Replace(str, "\n", `\n`, -1)
 	return strings.Replace(str, `"`, `\"`, -1)
 }
 
@@ -0,0 +1,196 @@
+package typhoon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type WorldConfig struct {
+	Gamemode   Gamemode   `json:"gamemode"`
+	Dimension  Dimension  `json:"dimension"`
+	Difficulty Difficulty `json:"difficulty"`
+	LevelType  LevelType  `json:"level_type"`
+}
+
+// VirtualHostConfig overrides the main configuration for players joining
+// through a given hostname. Empty values inherit from the main
+// configuration.
+type VirtualHostConfig struct {
+	Motd       string       `json:"motd"`
+	Favicon    string       `json:"favicon"`
+	MaxPlayers int          `json:"max_players"`
+	Brand      string       `json:"brand"`
+	World      *WorldConfig `json:"world,omitempty"`
+}
+
+type virtualHostHandlers struct {
+	join      map[string]func(player *Player)
+	joinMutex *sync.RWMutex
+}
+
+func newVirtualHostHandlers() *virtualHostHandlers {
+	return &virtualHostHandlers{
+		join:      make(map[string]func(player *Player)),
+		joinMutex: &sync.RWMutex{},
+	}
+}
+
+// NormalizeHostname turns a handshake address into the form used to match
+// virtual hosts: the Forge marker and any trailing dot are removed and the
+// result is lowercased.
+func NormalizeHostname(address string) string {
+	if i := strings.IndexByte(address, 0); i != -1 {
+		address = address[:i]
+	}
+	address = strings.TrimRight(address, ".")
+	return strings.ToLower(address)
+}
+
+func validateVirtualHosts(hosts map[string]VirtualHostConfig) error {
+	for name, host := range hosts {
+		if name == "" || NormalizeHostname(name) != name {
+			return fmt.Errorf("virtual_hosts: %q must be a lowercase hostname", name)
+		}
+		if strings.Contains(name, "*") && !strings.HasPrefix(name, "*.") {
+			return fmt.Errorf("virtual_hosts: %q, wildcards are only allowed as the first label", name)
+		}
+		if host.MaxPlayers < 0 {
+			return errors.New("virtual_hosts: " + name + ": max_players must not be negative")
+		}
+	}
+	return nil
+}
+
+func loadVirtualHostFavicons(hosts map[string]VirtualHostConfig) (map[string]string, error) {
+	favicons := make(map[string]string)
+	for name, host := range hosts {
+		if host.Favicon == "" {
+			continue
+		}
+		favicon, err := loadFavicon(host.Favicon)
+		if err != nil {
+			return nil, fmt.Errorf("virtual_hosts: %s: %v", name, err)
+		}
+		favicons[name] = favicon
+	}
+	return favicons, nil
+}
+
+// matchVirtualHost returns the name of the virtual host profile serving
+// hostname, trying an exact match first and then wildcard profiles from
+// the most to the least specific.
+func (c *Core) matchVirtualHost(hostname string) string {
+	hosts := c.getConfig().VirtualHosts
+	if _, ok := hosts[hostname]; ok {
+		return hostname
+	}
+	for suffix := hostname; ; {
+		i := strings.IndexByte(suffix, '.')
+		if i == -1 {
+			return ""
+		}
+		suffix = suffix[i+1:]
+		if _, ok := hosts["*."+suffix]; ok {
+			return "*." + suffix
+		}
+	}
+}
+
+// OnVirtualHostJoin registers the function called when a player joins
+// through the given virtual host, right before the PlayerJoinEvent.
+func (c *Core) OnVirtualHostJoin(name string, handler func(player *Player)) {
+	c.virtualHostHandlers.joinMutex.Lock()
+	c.virtualHostHandlers.join[name] = handler
+	c.virtualHostHandlers.joinMutex.Unlock()
+}
+
+func (c *Core) virtualHostJoinHandler(name string) func(player *Player) {
+	c.virtualHostHandlers.joinMutex.RLock()
+	handler := c.virtualHostHandlers.join[name]
+	c.virtualHostHandlers.joinMutex.RUnlock()
+	return handler
+}
+
+func (player *Player) virtualHostConfig() (VirtualHostConfig, bool) {
+	if player.virtualHost == "" {
+		return VirtualHostConfig{}, false
+	}
+	host, ok := player.core.getConfig().VirtualHosts[player.virtualHost]
+	return host, ok
+}
+
+// GetVirtualHost returns the name of the virtual host profile the player
+// connected through, or an empty string if none matched.
+func (player *Player) GetVirtualHost() string {
+	return player.virtualHost
+}
+
+// GetHostname returns the normalized address the player used to connect.
+func (player *Player) GetHostname() string {
+	return NormalizeHostname(player.inaddr.address)
+}
+
+func (player *Player) getMotd() string {
+	if host, ok := player.virtualHostConfig(); ok && host.Motd != "" {
+		return host.Motd
+	}
+	return player.core.getConfig().Motd
+}
+
+func (player *Player) getMaxPlayers() int {
+	if host, ok := player.virtualHostConfig(); ok && host.MaxPlayers != 0 {
+		return host.MaxPlayers
+	}
+	return player.core.getConfig().MaxPlayers
+}
+
+func (player *Player) getFavicon() string {
+	if player.virtualHost != "" {
+		if favicon, ok := player.core.config.Load().(*loadedConfig).hostFavicons[player.virtualHost]; ok {
+			return favicon
+		}
+	}
+	return player.core.getFavicon()
+}
+
+func (player *Player) getBrand() string {
+	if host, ok := player.virtualHostConfig(); ok && host.Brand != "" {
+		return host.Brand
+	}
+	return player.core.brand
+}
+
+func (player *Player) getJoinGame() *PacketPlayJoinGame {
+	host, ok := player.virtualHostConfig()
+	if !ok || host.World == nil {
+		return &player.core.joinGame
+	}
+	joinGame := player.core.joinGame
+	joinGame.Gamemode = host.World.Gamemode
+	joinGame.Dimension = host.World.Dimension
+	joinGame.Difficulty = host.World.Difficulty
+	if host.World.LevelType != "" {
+		joinGame.LevelType = host.World.LevelType
+	}
+	return &joinGame
+}
+
+// getPlayerCount returns the number of players sharing the player's
+// virtual host, or the whole server count without one.
+func (player *Player) getPlayerCount() int {
+	reg := player.core.playerRegistry
+	if player.virtualHost == "" {
+		return reg.GetPlayerCount()
+	}
+	count := 0
+	reg.playersMutex.RLock()
+	for _, pl := range reg.players {
+		if pl.virtualHost == player.virtualHost {
+			count++
+		}
+	}
+	reg.playersMutex.RUnlock()
+	return count
+}
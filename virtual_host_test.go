@@ -0,0 +1,47 @@
+package typhoon
+
+import (
+	"testing"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	cases := map[string]string{
+		"Play.Example.com":              "play.example.com",
+		"play.example.com.":             "play.example.com",
+		"play.example.com\x00FML\x00":   "play.example.com",
+		"play.example.com.\x00FML2\x00": "play.example.com",
+	}
+	for address, expected := range cases {
+		if got := NormalizeHostname(address); got != expected {
+			t.Logf("NormalizeHostname(%q) = %q instead of %q", address, got, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestMatchVirtualHost(t *testing.T) {
+	config := DefaultConfig()
+	config.Favicon = ""
+	config.VirtualHosts = map[string]VirtualHostConfig{
+		"hub.example.com": {Motd: "Hub"},
+		"*.example.com":   {Motd: "Any"},
+	}
+	c, err := InitWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"hub.example.com":     "hub.example.com",
+		"limbo.example.com":   "*.example.com",
+		"a.limbo.example.com": "*.example.com",
+		"example.com":         "",
+		"example.org":         "",
+	}
+	for hostname, expected := range cases {
+		if got := c.matchVirtualHost(hostname); got != expected {
+			t.Logf("matchVirtualHost(%q) = %q instead of %q", hostname, got, expected)
+			t.Fail()
+		}
+	}
+}